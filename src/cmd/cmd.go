@@ -1,6 +1,10 @@
 package cmd
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
 
 type Search struct {
 	Query string
@@ -14,9 +18,28 @@ func SearchCmd(query string) tea.Cmd {
 	}
 }
 
+type SearchMore struct {
+	Query  string
+	Offset int
+	// Token is the continue token returned with the previous results.
+	Token string
+}
+
+func SearchMoreCmd(query string, offset int, token string) tea.Cmd {
+	return func() tea.Msg {
+		return SearchMore{
+			Query:  query,
+			Offset: offset,
+			Token:  token,
+		}
+	}
+}
+
 type OpenArticle struct {
 	PageId int
 	Name   string
+	// Section is the anchor of the section to scroll to once opened.
+	Section string
 }
 
 func OpenArticleWithIdCmd(pageId int) tea.Cmd {
@@ -26,10 +49,46 @@ func OpenArticleWithIdCmd(pageId int) tea.Cmd {
 		}
 	}
 }
+
+// OpenArticleWithNameCmd opens an article by its title, which may end in
+// the anchor of a section, like "Slayer#Rewards".
 func OpenArticleWithNameCmd(name string) tea.Cmd {
+	name, section, _ := strings.Cut(name, "#")
 	return func() tea.Msg {
 		return OpenArticle{
+			Name:    strings.TrimSpace(name),
+			Section: strings.TrimSpace(section),
+		}
+	}
+}
+
+// QueueArticle keeps an article to be opened later, for links that are
+// opened in the background.
+type QueueArticle struct {
+	Name string
+}
+
+func QueueArticleWithNameCmd(name string) tea.Cmd {
+	return func() tea.Msg {
+		return QueueArticle{
 			Name: name,
 		}
 	}
 }
+
+type FetchStarted struct {
+	Id    int
+	Label string
+}
+
+type FetchSucceeded struct {
+	Id     int
+	Result tea.Msg
+}
+
+type FetchFailed struct {
+	Id  int
+	Err error
+	// Retry restarts the failed action.
+	Retry tea.Cmd
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/zerolog/log"
 )
@@ -9,6 +11,24 @@ type AppConfig struct {
 	Port   string `default:"5250"`
 	Host   string `default:"localhost"`
 	IDFile string `default:".ssh/id_ed25519"`
+
+	WikiApiUrl    string        `split_words:"true" default:"https://oldschool.runescape.wiki/api.php"`
+	WikiTimeout   time.Duration `split_words:"true" default:"10s"`
+	WikiUserAgent string        `split_words:"true" default:"osrs.sh - ssh wiki (https://github.com/stinodes/osrs.sh)"`
+	WikiMaxConns  int           `split_words:"true" default:"16"`
+	// WikiRateLimit is the number of requests per second made to the wiki,
+	// across all sessions.
+	WikiRateLimit float64 `split_words:"true" default:"5"`
+	WikiRateBurst int     `split_words:"true" default:"10"`
+
+	// PageCacheSize is the memory bound of the page cache in MiB.
+	PageCacheSize int           `split_words:"true" default:"64"`
+	PageCacheTtl  time.Duration `split_words:"true" default:"15m"`
+	PageCacheDir  string        `split_words:"true"`
+
+	// Hyperlinks sets whether external links are sent as OSC 8 hyperlinks:
+	// "auto" to detect it from the terminal, "always" or "never".
+	Hyperlinks string `default:"auto"`
 }
 
 func LoadAppConfig() (c AppConfig, err error) {
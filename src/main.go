@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 
 	"osrs.sh/wiki/ssh/src/config"
 	"osrs.sh/wiki/ssh/src/views/layout"
+	"osrs.sh/wiki/ssh/src/wiki"
 )
 
 func main() {
@@ -28,11 +30,17 @@ func main() {
 
 	log.Info("Starting server with config", "config", config)
 
+	client := wiki.NewClient(
+		config,
+		wiki.WithPageCache(wiki.NewPageCache(config)),
+		wiki.WithRateLimiter(wiki.NewRateLimiter(config.WikiRateLimit, config.WikiRateBurst)),
+	)
+
 	server, err := wish.NewServer(
 		wish.WithAddress(net.JoinHostPort(config.Host, config.Port)),
 		wish.WithHostKeyPath(config.IDFile),
 		wish.WithMiddleware(
-			bubbletea.Middleware(teaHandler),
+			bubbletea.Middleware(teaHandler(client, config.Hyperlinks)),
 			logging.Middleware(),
 		),
 	)
@@ -61,7 +69,39 @@ func main() {
 
 }
 
-func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
-	renderer := bubbletea.MakeRenderer(s)
-	return layout.New(renderer), []tea.ProgramOption{tea.WithAltScreen()}
+func teaHandler(client wiki.Client, hyperlinks string) bubbletea.Handler {
+	return func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+		renderer := bubbletea.MakeRenderer(s)
+		return layout.New(
+			renderer,
+			client,
+			s.Context(),
+			hyperlinks == "always" || hyperlinks == "auto" && supportsHyperlinks(s),
+		), []tea.ProgramOption{tea.WithAltScreen()}
+	}
+}
+
+// Terminals known to support OSC 8 hyperlinks, by their TERM or
+// TERM_PROGRAM.
+var hyperlinkTerminals = []string{
+	"kitty", "wezterm", "alacritty", "foot", "ghostty", "contour", "iterm", "vscode", "rio",
+}
+
+func supportsHyperlinks(s ssh.Session) bool {
+	pty, _, _ := s.Pty()
+	terms := []string{strings.ToLower(pty.Term)}
+	for _, env := range s.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if name == "TERM_PROGRAM" {
+			terms = append(terms, strings.ToLower(value))
+		}
+	}
+	for _, term := range terms {
+		for _, t := range hyperlinkTerminals {
+			if strings.Contains(term, t) {
+				return true
+			}
+		}
+	}
+	return false
 }
@@ -1,9 +1,62 @@
 package utils
 
-func ReverseString(s string) string {
-	runes := []rune(s)
-	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
-		runes[i], runes[j] = runes[j], runes[i]
+import (
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func FormatNumber(n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteRune(',')
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String()
+}
+
+// Overlay draws top over base, with its top left corner at column x and
+// line y. Styling of base outside of the overlaid area is kept.
+func Overlay(base string, top string, x int, y int) string {
+	lines := strings.Split(base, "\n")
+	for i, line := range strings.Split(top, "\n") {
+		if y+i < 0 || y+i >= len(lines) {
+			continue
+		}
+		baseLine := lines[y+i]
+		left := ansi.Truncate(baseLine, x, "")
+		if pad := x - ansi.StringWidth(left); pad > 0 {
+			left += strings.Repeat(" ", pad)
+		}
+		right := skipCells(baseLine, x+ansi.StringWidth(line))
+		lines[y+i] = left + "\x1b[0m" + line + "\x1b[0m" + right
+	}
+	return strings.Join(lines, "\n")
+}
+
+// skipCells drops the first n cells of s, keeping any escape sequences so
+// the remainder is styled as before.
+func skipCells(s string, n int) string {
+	var b strings.Builder
+	var state byte
+	width := 0
+	for len(s) > 0 {
+		seq, w, size, newState := ansi.DecodeSequence(s, state, nil)
+		state = newState
+		if w == 0 || width >= n {
+			b.WriteString(seq)
+		}
+		width += w
+		s = s[size:]
 	}
-	return string(runes)
+	return b.String()
 }
@@ -2,7 +2,6 @@ package articlepane
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -15,28 +14,29 @@ import (
 	"osrs.sh/wiki/ssh/src/wiki"
 )
 
-type ActionInput string
-
-const (
-	Up       ActionInput = "k"
-	Down     ActionInput = "j"
-	Left     ActionInput = "h"
-	Right    ActionInput = "h"
-	Top      ActionInput = "gg"
-	Bottom   ActionInput = "G"
-	NextLink ActionInput = "l"
-	PrevLink ActionInput = "h"
-	Confirm  ActionInput = "enter"
-)
-
 type styles struct {
-	body     lipgloss.Style
-	title    lipgloss.Style
-	bold     lipgloss.Style
-	link     lipgloss.Style
-	selected lipgloss.Style
-	content  lipgloss.Style
-	lineCol  lipgloss.Style
+	body         lipgloss.Style
+	title        lipgloss.Style
+	bold         lipgloss.Style
+	italic       lipgloss.Style
+	boldItalic   lipgloss.Style
+	ref          lipgloss.Style
+	link         lipgloss.Style
+	externalLink lipgloss.Style
+	selected     lipgloss.Style
+	lineCol      lipgloss.Style
+	notice       lipgloss.Style
+	card         lipgloss.Style
+	cardLabel    lipgloss.Style
+	tableBorder  lipgloss.Style
+	tableHeader  lipgloss.Style
+	toc          lipgloss.Style
+	tocTitle     lipgloss.Style
+	tocCurrent   lipgloss.Style
+	match        lipgloss.Style
+	currentMatch lipgloss.Style
+	status       lipgloss.Style
+	hint         lipgloss.Style
 }
 type Model struct {
 	r           *lipgloss.Renderer
@@ -44,21 +44,30 @@ type Model struct {
 	height      int
 	styles      styles
 	tokenStyles map[wiki.WikiTokenType]*lipgloss.Style
+	hyperlinks  bool
 
-	page   *wiki.Page
-	parser wiki.Parser
+	page     *wiki.Page
+	document document
+	cache    *layoutCache
 
-	buffer        []string
+	count         string
+	keys          []string
+	marks         map[string]int
 	scrollPos     int
 	content       string
+	notice        string
 	selectedToken int
+	version       int
+	tableStates   []tableState
+	prices        map[string]int
+	toc           toc
+	search        search
+	hints         hints
 }
 
-var numberRegex = regexp.MustCompile(`(\d+)`)
-
 const numberWidth = 5
 
-func New(renderer *lipgloss.Renderer, w int, h int) Model {
+func New(renderer *lipgloss.Renderer, w int, h int, hyperlinks bool) Model {
 	s := styles{
 		body: renderer.
 			NewStyle().
@@ -71,28 +80,83 @@ func New(renderer *lipgloss.Renderer, w int, h int) Model {
 		bold: renderer.
 			NewStyle().
 			Bold(true),
+		italic: renderer.
+			NewStyle().
+			Italic(true),
+		boldItalic: renderer.
+			NewStyle().
+			Bold(true).
+			Italic(true),
+		ref: renderer.
+			NewStyle().
+			Foreground(style.LinkForeground).
+			Faint(true),
 		link: renderer.
 			NewStyle().
 			Foreground(style.LinkForeground),
+		externalLink: renderer.
+			NewStyle().
+			Foreground(style.LinkForeground).
+			Underline(true),
 		selected: renderer.
 			NewStyle().
 			Background(style.SelectedBackground),
-		content: renderer.NewStyle().Width(w - numberWidth),
 		lineCol: renderer.NewStyle().
 			MaxWidth(numberWidth).
 			Foreground(style.SubtleForeground),
+		notice: renderer.NewStyle().
+			Foreground(style.DimmedForeground).
+			Italic(true),
+		card: renderer.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(style.BorderForeground).
+			Padding(0, 1),
+		cardLabel: renderer.NewStyle().
+			Foreground(style.DimmedForeground),
+		tableBorder: renderer.NewStyle().
+			Foreground(style.DimmedForeground),
+		tableHeader: renderer.NewStyle().
+			Bold(true),
+		toc: renderer.NewStyle().
+			Border(lipgloss.NormalBorder(), false, true, false, false).
+			BorderForeground(style.BorderForeground).
+			PaddingRight(1).
+			MarginRight(1),
+		tocTitle: renderer.NewStyle().
+			Foreground(style.DimmedForeground),
+		tocCurrent: renderer.NewStyle().
+			Foreground(style.AccentForeground).
+			Bold(true),
+		match: renderer.NewStyle().
+			Background(style.LinkForeground).
+			Foreground(style.SubtleForeground),
+		currentMatch: renderer.NewStyle().
+			Background(style.SelectedBackground),
+		status: renderer.NewStyle().
+			Foreground(style.DimmedForeground),
+		hint: renderer.NewStyle().
+			Background(style.AccentForeground).
+			Foreground(style.PrimaryForeground).
+			Bold(true),
 	}
 	return Model{
 		r:      renderer,
 		styles: s,
 		tokenStyles: map[wiki.WikiTokenType]*lipgloss.Style{
-			wiki.TitleToken: &s.title,
-			wiki.LinkToken:  &s.link,
-			wiki.BoldToken:  &s.bold,
+			wiki.TitleToken:        &s.title,
+			wiki.LinkToken:         &s.link,
+			wiki.BoldToken:         &s.bold,
+			wiki.ItalicToken:       &s.italic,
+			wiki.BoldItalicToken:   &s.boldItalic,
+			wiki.RefToken:          &s.ref,
+			wiki.NoteToken:         &s.ref,
+			wiki.ExternalLinkToken: &s.externalLink,
 		},
+		hyperlinks:    hyperlinks,
 		page:          nil,
-		parser:        wiki.Parser{},
-		buffer:        []string{},
+		document:      document{},
+		cache:         newLayoutCache(),
+		marks:         map[string]int{},
 		scrollPos:     0,
 		content:       "",
 		selectedToken: -1,
@@ -106,37 +170,57 @@ func (m Model) Init() tea.Cmd {
 func (m Model) SetPage(page *wiki.Page) Model {
 	log.Info("SetPage", "page", page)
 	m.page = page
-	m.parser = wiki.NewParser(
-		page.WikiText,
-		map[wiki.WikiTokenType]*lipgloss.Style{
-			wiki.TitleToken: &m.styles.title,
-			wiki.BoldToken:  &m.styles.bold,
-			wiki.LinkToken:  &m.styles.link,
-		},
-	)
+	m.document = render(wiki.Parse(page.WikiText), m.hyperlinks)
+	m.cache = newLayoutCache()
+	m.version = 0
+	m.tableStates = make([]tableState, len(m.document.tables))
+	m.prices = nil
+	m.toc = toc{entries: tocEntries(page, m.document), visible: m.toc.visible}
+	m.search = search{current: -1}
+	m.marks = map[string]int{}
+	m.hints = hints{}
+
+	m.notice = ""
+	from, fragment := page.RedirectedFrom()
+	if from != "" {
+		m.notice = "Redirected from " + from
+	}
+	if fragment != "" {
+		m.ScrollToSection(fragment)
+	}
 	return m
 }
+func (m Model) PageId() int {
+	if m.page == nil {
+		return 0
+	}
+	return m.page.PageID
+}
 func (m *Model) Resize(width, height int) {
 	m.width = width
 	m.height = height
-	m.styles.content.Width(width - numberWidth)
 	m.scrollPos = m.constrainScrollPos(m.scrollPos)
 }
 
+// pageHeight is the number of lines of the article in view, which leaves
+// room for the search status when there is one.
+func (m Model) pageHeight() int {
+	if m.search.typing || m.search.query != "" {
+		return max(m.height-1, 1)
+	}
+	return m.height
+}
+
 func (m *Model) contentLength() int {
-	return len(strings.Split(
-		m.styles.content.Render(m.parser.Text()),
-		"\n",
-	),
-	)
+	return len(m.layout().lines)
 }
 
 func (m Model) constrainScrollPos(pos int) int {
 	if pos < 0 {
 		pos = 0
 	}
-	if pos > m.contentLength() {
-		pos = m.contentLength() - 1
+	if pos >= m.contentLength() {
+		pos = max(m.contentLength()-1, 0)
 	}
 	return pos
 }
@@ -154,130 +238,261 @@ func (m *Model) ScrollUp(delta int) {
 }
 func (m *Model) ScrollTo(line int) {
 	if line == 0 {
-		line = m.contentLength() - m.height/2
+		line = m.contentLength() - m.pageHeight()/2
 	}
 	m.scrollPos = m.constrainScrollPos(line)
 }
-func (m *Model) ScrollToTop(_ int) {
-	m.ScrollTo(1)
+func (m *Model) ScrollToTop(line int) {
+	m.scrollPos = m.constrainScrollPos(line)
 }
 func (m *Model) ScrollToBottom(_ int) {
-	m.ScrollTo(m.contentLength() - m.height/2)
+	m.ScrollTo(m.contentLength() - m.pageHeight()/2)
 }
-func (m *Model) ScrollToToken(token wiki.DefaultToken) {
-	line := m.lineFor(token.Placeholder())
-	if !m.isInView(token.Placeholder()) {
-		offset := -5
 
-		if line > m.scrollPos {
-			offset = -m.height - offset
-		}
-
-		m.ScrollTo(line + offset)
+// HalfPageDown and HalfPageUp scroll half a page, or as many lines as the
+// count.
+func (m *Model) HalfPageDown(n int) {
+	if n == 0 {
+		n = max(m.pageHeight()/2, 1)
 	}
+	m.Scroll(n)
 }
-func (m *Model) SelectToken(token wiki.DefaultToken) {
-	m.selectedToken = token.Id()
-	m.ScrollToToken(token)
+func (m *Model) HalfPageUp(n int) {
+	if n == 0 {
+		n = max(m.pageHeight()/2, 1)
+	}
+	m.ScrollUp(n)
+}
+
+// PageDown and PageUp scroll a page at a time, keeping two lines of the
+// last one in view.
+func (m *Model) PageDown(n int) {
+	m.Scroll(max(n, 1) * max(m.pageHeight()-2, 1))
+}
+func (m *Model) PageUp(n int) {
+	m.ScrollUp(max(n, 1) * max(m.pageHeight()-2, 1))
+}
+
+// scrollForward scrolls to the nth of lines after the top of the view, and
+// scrollBackward to the nth before it.
+func (m *Model) scrollForward(lines []int, n int) {
+	for n = max(n, 1); n > 0; n-- {
+		for _, line := range lines {
+			if line > m.scrollPos {
+				m.scrollPos = m.constrainScrollPos(line)
+				break
+			}
+		}
+	}
 }
-func (m *Model) NextLink(id int) {
-	cur := m.parser.TokenById(m.selectedToken)
-	linkVisible := cur != nil && m.isInView(cur.Placeholder())
-
-	if !linkVisible {
-		viewableContent := m.viewableContent()
-		for i := 0; i < len(m.parser.Tokens()); i++ {
-			token := m.parser.TokenById(i)
-			if token != nil &&
-				token.TokenType() == wiki.LinkToken &&
-				strings.Contains(viewableContent, token.Placeholder()) {
-				m.SelectToken(*token)
+func (m *Model) scrollBackward(lines []int, n int) {
+	for n = max(n, 1); n > 0; n-- {
+		for i := len(lines) - 1; i >= 0; i-- {
+			if lines[i] < m.scrollPos {
+				m.scrollPos = m.constrainScrollPos(lines[i])
 				break
 			}
 		}
+	}
+}
 
-		return
+// paragraphLines returns the first line of every paragraph.
+func (m Model) paragraphLines() []int {
+	lines := m.layout().lines
+	starts := []int{}
+	for i, l := range lines {
+		if !l.blank() && (i == 0 || lines[i-1].blank()) {
+			starts = append(starts, i)
+		}
 	}
+	return starts
+}
+func (m *Model) NextParagraph(n int) {
+	m.scrollForward(m.paragraphLines(), n)
+}
+func (m *Model) PrevParagraph(n int) {
+	m.scrollBackward(m.paragraphLines(), n)
+}
 
-	tokens := m.parser.Tokens()
-	for i := cur.Id() + 1; i < len(m.parser.Tokens()); i++ {
-		if tokens[i].TokenType() == wiki.LinkToken {
-			m.SelectToken(tokens[i])
-			break
+// ScreenTop, ScreenMiddle and ScreenBottom select the link closest to the
+// top, middle or bottom of the view. Counts are lines from the top or
+// bottom.
+func (m *Model) ScreenTop(n int) {
+	m.selectNear(m.scrollPos + max(n-1, 0))
+}
+func (m *Model) ScreenMiddle(_ int) {
+	m.selectNear(m.scrollPos + (m.lastLineInView()-m.scrollPos)/2)
+}
+func (m *Model) ScreenBottom(n int) {
+	m.selectNear(m.lastLineInView() - max(n-1, 0))
+}
+func (m Model) lastLineInView() int {
+	return min(m.scrollPos+m.pageHeight(), m.contentLength()) - 1
+}
+
+// selectNear selects the link in view that is closest to a line.
+func (m *Model) selectNear(line int) {
+	selected, distance := -1, 0
+	for _, token := range m.document.Tokens() {
+		if !selectable(token) || !m.isInView(token) {
+			continue
+		}
+		l, _ := m.lineFor(token)
+		d := max(l-line, line-l)
+		if selected == -1 || d < distance {
+			selected, distance = token.Id(), d
 		}
 	}
+	if selected != -1 {
+		m.selectedToken = selected
+	}
 }
-func (m *Model) PrevLink(id int) {
-	cur := m.parser.TokenById(m.selectedToken)
-	linkVisible := cur != nil && m.isInView(cur.Placeholder())
 
-	if !linkVisible {
-		viewableContent := m.viewableContent()
-		for i := len(m.parser.Tokens()) - 1; i >= 0; i-- {
-			token := m.parser.TokenById(i)
-			if token != nil &&
-				token.TokenType() == wiki.LinkToken &&
-				strings.Contains(viewableContent, token.Placeholder()) {
-				m.SelectToken(*token)
-				break
-			}
+// Center scrolls the selected link to the middle of the view, or the line
+// of the count.
+func (m *Model) Center(n int) {
+	line := n
+	if n == 0 {
+		token := m.document.TokenById(m.selectedToken)
+		if token == nil || !m.isInView(*token) {
+			return
+		}
+		line, _ = m.lineFor(*token)
+	}
+	m.scrollPos = m.constrainScrollPos(line - m.pageHeight()/2)
+}
+func (m *Model) ScrollToToken(token wiki.DefaultToken) {
+	line, ok := m.lineFor(token)
+	if ok && !m.isInView(token) {
+		offset := -5
+
+		if line > m.scrollPos {
+			offset = -m.pageHeight() - offset
 		}
 
+		m.scrollPos = m.constrainScrollPos(line + offset)
+	}
+}
+
+// ScrollToSection scrolls to the heading of the section an anchor links to,
+// looked up in the sections of the page when it has them.
+func (m *Model) ScrollToSection(anchor string) {
+	heading, occurrence := anchor, 0
+	if m.page != nil {
+		if h, o, ok := m.page.Section(anchor); ok {
+			heading, occurrence = h, o
+		}
+	}
+
+	heading = wiki.NormalizeAnchor(heading)
+	for _, token := range m.document.Tokens() {
+		if token.TokenType() != wiki.TitleToken || wiki.NormalizeAnchor(token.Content()) != heading {
+			continue
+		}
+		if occurrence > 0 {
+			occurrence--
+			continue
+		}
+		line, _ := m.lineFor(token)
+		m.scrollPos = m.constrainScrollPos(line)
 		return
 	}
+}
+func (m *Model) SelectToken(token wiki.DefaultToken) {
+	m.selectedToken = token.Id()
+	m.ScrollToToken(token)
+}
+func (m *Model) NextLink(n int) {
+	for n = max(n, 1); n > 0; n-- {
+		m.stepLink(1)
+	}
+}
+func (m *Model) PrevLink(n int) {
+	for n = max(n, 1); n > 0; n-- {
+		m.stepLink(-1)
+	}
+}
 
-	tokens := m.parser.Tokens()
-	for i := cur.Id() - 1; i >= 0; i++ {
-		if tokens[i].TokenType() == wiki.LinkToken {
+// stepLink selects the next or previous link, or the first or last one in
+// view when the selected link is not.
+func (m *Model) stepLink(step int) {
+	tokens := m.document.Tokens()
+	cur := m.document.TokenById(m.selectedToken)
+	inView := cur != nil && m.isInView(*cur)
+
+	start := 0
+	switch {
+	case inView:
+		start = cur.Id() + step
+	case step < 0:
+		start = len(tokens) - 1
+	}
+	for i := start; i >= 0 && i < len(tokens); i += step {
+		if selectable(tokens[i]) && (inView || m.isInView(tokens[i])) {
 			m.SelectToken(tokens[i])
-			break
+			return
 		}
 	}
 }
 
-func matches(input string, match ActionInput) bool {
-	return strings.HasPrefix(input, string(match))
+// isSamePage reports whether a link points to a section of the current page,
+// like [[#Drops]].
+func (m Model) isSamePage(target string) bool {
+	title, section, found := strings.Cut(target, "#")
+	if !found || section == "" {
+		return false
+	}
+	return strings.TrimSpace(title) == "" ||
+		m.page != nil && wiki.NormalizeTitle(title) == wiki.NormalizeTitle(m.page.Title)
 }
-func (m *Model) Push(input string) tea.Cmd {
-	m.buffer = append([]string{input}, m.buffer...)
-	bufferString := strings.Join(m.buffer, "")
-	cur := bufferString
-
-	var action func(n int)
 
-	log.Info("Push", "input", input, "buffer", m.buffer)
+// selectable reports whether a token can be selected to act on it.
+func selectable(token wiki.DefaultToken) bool {
+	switch token.TokenType() {
+	case wiki.LinkToken, wiki.ExternalLinkToken, wiki.RefToken, wiki.NoteToken:
+		return true
+	}
+	return false
+}
 
-	switch {
-	case matches(cur, Up):
-		action = m.ScrollUp
-	case matches(cur, Down):
-		action = m.Scroll
-	case matches(cur, Top):
-		action = m.ScrollToTop
-	case matches(cur, Bottom):
-		action = m.ScrollTo
-	case matches(cur, NextLink):
-		action = m.NextLink
-	case matches(cur, PrevLink):
-		action = m.PrevLink
-	case matches(cur, Confirm):
-		token := m.parser.TokenById(m.selectedToken)
-		if token != nil {
-			return cmd.OpenArticleWithNameCmd(token.Target())
+// jumpToToken selects the first token of a type with the given target, such
+// as the note a footnote marker refers to.
+func (m *Model) jumpToToken(tokenType wiki.WikiTokenType, target string) {
+	for _, token := range m.document.Tokens() {
+		if token.TokenType() == tokenType && token.Target() == target {
+			m.SelectToken(token)
+			return
 		}
 	}
+}
 
-	if action != nil {
-		numberMatches := numberRegex.FindAllStringSubmatch(cur, -1)
-		num := 0
-		if len(numberMatches) > 0 {
-			numberStr := numberMatches[0][len(numberMatches)-1]
-			num, _ = strconv.Atoi(utils.ReverseString(numberStr))
+// Confirm follows the selected link.
+func (m *Model) Confirm(_ int) tea.Cmd {
+	token := m.document.TokenById(m.selectedToken)
+	if token == nil {
+		return nil
+	}
+	return m.follow(*token)
+}
+func (m *Model) follow(token wiki.DefaultToken) tea.Cmd {
+	switch {
+	case token.TokenType() == wiki.RefToken:
+		m.jumpToToken(wiki.NoteToken, token.Target())
+	case token.TokenType() == wiki.NoteToken:
+		m.jumpToToken(wiki.RefToken, token.Target())
+	case token.TokenType() == wiki.ExternalLinkToken:
+		// These can only be opened by the terminal, so go to the
+		// footnote with their URL when there is one.
+		ref := m.document.TokenById(token.Id() + 1)
+		if !m.hyperlinks && ref != nil && ref.TokenType() == wiki.RefToken {
+			m.jumpToToken(wiki.NoteToken, ref.Target())
 		}
-		action(num)
-		m.buffer = []string{}
+	case m.isSamePage(token.Target()):
+		_, section, _ := strings.Cut(token.Target(), "#")
+		m.ScrollToSection(section)
+	default:
+		return cmd.OpenArticleWithNameCmd(token.Target())
 	}
-
 	return nil
 }
 
@@ -294,36 +509,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m Model) lineCol() string {
 	lines := ""
-	for i := m.scrollPos; i < m.scrollPos+m.height; i++ {
+	for i := max(m.scrollPos, 0); i < m.scrollPos+m.pageHeight(); i++ {
 		lines += fmt.Sprintf("%-*s\n", numberWidth, strconv.Itoa(i))
 	}
 	return m.styles.lineCol.
-		MaxHeight(m.height).
+		MaxHeight(m.pageHeight()).
 		Render(lines)
 }
-func (m Model) lineFor(text string) int {
-	before := strings.Split(
-		m.renderedContent(),
-		text,
-	)[0]
 
-	return len(strings.Split(before, "\n")) - 1
-}
-func (m Model) isInView(text string) bool {
-	return strings.Contains(m.viewableContent(), text)
-}
-func (m Model) viewableContent() string {
-	lines := strings.Split(
-		m.renderedContent(), "\n")
-	if len(lines) <= 1 {
-		return ""
-	}
-	start := m.scrollPos
-	end := m.constrainScrollPos(m.scrollPos + m.height)
-	return strings.Join(lines[start:end], "\n")
+// lineFor returns the line a token starts at, if it is shown.
+func (m Model) lineFor(token wiki.DefaultToken) (int, bool) {
+	line, ok := m.layout().tokenLines[token.Id()]
+	return line, ok
 }
-func (m Model) renderedContent() string {
-	return m.styles.content.Render(m.parser.Text())
+func (m Model) isInView(token wiki.DefaultToken) bool {
+	line, ok := m.lineFor(token)
+	return ok && line >= m.scrollPos && line < m.scrollPos+m.pageHeight()
 }
 
 func (m Model) View() string {
@@ -331,23 +532,42 @@ func (m Model) View() string {
 		return "Loading..."
 	}
 
-	c := m.viewableContent()
+	lines := m.layout().lines
+	matches := m.searchMatches()
+	var current *searchMatch
+	if m.search.current >= 0 && m.search.current < len(matches) {
+		current = &matches[m.search.current]
+	}
 
-	for _, token := range m.parser.Tokens() {
-		style := m.tokenStyles[token.TokenType()]
-		tokenContent := token.Content()
-		if style != nil {
-			tokenContent = style.Render(token.Content())
-			if m.selectedToken == token.Id() {
-				tokenContent = m.styles.selected.Render(tokenContent)
+	views := []string{}
+	for i := max(m.scrollPos, 0); i < min(m.scrollPos+m.pageHeight(), len(lines)); i++ {
+		lineMatches := []searchMatch{}
+		for j, match := range matches {
+			if match.line == i {
+				lineMatches = append(lineMatches, matches[j])
 			}
 		}
-		c = strings.Replace(c, token.Placeholder(), tokenContent, 1)
+		view := m.lineView(lines[i])
+		if len(lineMatches) > 0 {
+			view = m.highlightedLineView(lines[i], lineMatches, current)
+		}
+		if m.hints.active {
+			view = m.hintedLineView(i, lines[i], view)
+		}
+		views = append(views, view)
 	}
+	c := strings.Join(views, "\n")
 
-	return lipgloss.JoinHorizontal(
-		lipgloss.Top,
-		m.lineCol(),
-		lipgloss.NewStyle().Render(c),
-	)
+	columns := []string{m.lineCol(), lipgloss.NewStyle().Render(c)}
+	if m.toc.visible {
+		columns = append([]string{m.tocView()}, columns...)
+	}
+	view := lipgloss.JoinHorizontal(lipgloss.Top, columns...)
+	if status := m.searchStatus(); status != "" {
+		view = lipgloss.JoinVertical(lipgloss.Left, view, status)
+	}
+	if pending := m.pendingView(); pending != "" {
+		view = utils.Overlay(view, pending, m.width-lipgloss.Width(pending), lipgloss.Height(view)-1)
+	}
+	return view
 }
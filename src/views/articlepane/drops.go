@@ -0,0 +1,162 @@
+package articlepane
+
+import (
+	"strconv"
+	"strings"
+
+	"osrs.sh/wiki/ssh/src/utils"
+	"osrs.sh/wiki/ssh/src/wiki"
+)
+
+// Items that are not traded on the Grand Exchange, but have a fixed value.
+var fixedPrices = map[string]int{
+	"coins": 1,
+}
+
+// dropsTable starts a table for the {{DropsLine}} templates that follow.
+func (r *renderer) dropsTable() *table {
+	header := []tableCell{}
+	for _, label := range []string{"Item", "Quantity", "Rarity", "GE value"} {
+		header = append(header, tableCell{text: label, header: true, colspan: 1})
+	}
+	t := &table{
+		sortable:   true,
+		priced:     true,
+		columns:    len(header),
+		headerRows: 1,
+		rows:       [][]tableCell{header},
+	}
+
+	r.tableBlock(t)
+	return t
+}
+
+func (r *renderer) dropsLine(t *table, drop wiki.Drop) {
+	if drop.Name == "" {
+		return
+	}
+
+	// The item is captured as a link, so it can be followed like any other.
+	spans := r.spans
+	r.spans = []span{}
+	r.link(&wiki.Link{
+		Target:   drop.Name,
+		Children: []wiki.Node{&wiki.Text{Value: drop.Name}},
+	})
+	item := r.spans
+	r.spans = spans
+
+	quantity := tableCell{text: drop.Quantity, colspan: 1}
+	if lo, _, ok := drop.QuantityRange(); ok {
+		quantity.value, quantity.numeric = float64(lo), true
+	}
+
+	rarity := tableCell{text: drop.Rarity, colspan: 1}
+	if chance, ok := drop.Chance(); ok || chance > 0 {
+		rarity.value, rarity.numeric = chance, true
+		if ok && chance < 1 {
+			rarity.text += " (" + strconv.FormatFloat(chance*100, 'g', 3, 64) + "%)"
+		}
+	}
+
+	t.rows = append(t.rows, []tableCell{
+		{text: drop.Name, spans: item, key: strings.ToLower(drop.Name), colspan: 1},
+		quantity,
+		rarity,
+		{price: drop.Name, quantity: drop.Quantity, colspan: 1},
+	})
+}
+
+// PriceItems returns the items the GE price is needed of.
+func (m Model) PriceItems() []string {
+	items := []string{}
+	for _, t := range m.document.tables {
+		for _, row := range t.rows {
+			for _, cell := range row {
+				_, fixed := fixedPrices[strings.ToLower(cell.price)]
+				if cell.price != "" && !fixed && !contains(items, cell.price) {
+					items = append(items, cell.price)
+				}
+			}
+		}
+	}
+	for _, token := range m.document.Tokens() {
+		if token.TokenType() == wiki.PriceToken && !contains(items, token.Target()) {
+			items = append(items, token.Target())
+		}
+	}
+	return items
+}
+
+func (m Model) SetPrices(prices map[string]int) Model {
+	m.prices = prices
+	// Prices are part of the wrapped text.
+	m.cache = newLayoutCache()
+	return m
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// priceText shows the GE price of a price token.
+func (m Model) priceText(token wiki.DefaultToken) string {
+	price, ok := m.prices[token.Target()]
+	quantity, _ := strconv.Atoi(token.Text())
+	switch {
+	case m.prices == nil:
+		return "…"
+	case !ok:
+		return "–"
+	}
+	return utils.FormatNumber(price*quantity) + " coins"
+}
+
+// withPrices returns a copy of the table with the GE value of its drops
+// filled in.
+func (m Model) withPrices(t *table) *table {
+	if !t.priced {
+		return t
+	}
+
+	cpy := *t
+	cpy.rows = make([][]tableCell, len(t.rows))
+	for i, row := range t.rows {
+		cpy.rows[i] = append([]tableCell{}, row...)
+		for j, cell := range row {
+			if cell.price != "" {
+				cpy.rows[i][j] = m.priceCell(cell)
+			}
+		}
+	}
+	return &cpy
+}
+
+func (m Model) priceCell(cell tableCell) tableCell {
+	price, ok := fixedPrices[strings.ToLower(cell.price)]
+	if !ok {
+		price, ok = m.prices[cell.price]
+	}
+	drop := wiki.Drop{Quantity: cell.quantity}
+	lo, hi, hasQuantity := drop.QuantityRange()
+
+	switch {
+	case m.prices == nil && !ok:
+		cell.text = "…"
+	case !ok || !hasQuantity:
+		cell.text = "–"
+	case lo == hi:
+		cell.text = utils.FormatNumber(price * lo)
+	default:
+		cell.text = utils.FormatNumber(price*lo) + "–" + utils.FormatNumber(price*hi)
+	}
+	if ok && hasQuantity {
+		cell.value, cell.numeric = float64(price*lo), true
+	}
+	return cell
+}
@@ -0,0 +1,131 @@
+package articlepane
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"osrs.sh/wiki/ssh/src/cmd"
+	"osrs.sh/wiki/ssh/src/utils"
+	"osrs.sh/wiki/ssh/src/wiki"
+)
+
+// hintKeys are the letters hints are made of, the easiest to reach first.
+const hintKeys = "asdfghjkl"
+
+// hints label the links in view, to follow one by typing its label, like f
+// in Vimium. While active, every key goes to them.
+type hints struct {
+	active bool
+	// background queues the link instead of opening it.
+	background bool
+	typed      string
+	// labels are the labels of the links by token id.
+	labels map[int]string
+}
+
+func (m *Model) StartHints(_ int) {
+	m.startHints(false)
+}
+func (m *Model) StartBackgroundHints(_ int) {
+	m.startHints(true)
+}
+func (m *Model) startHints(background bool) {
+	links := []int{}
+	for _, token := range m.document.Tokens() {
+		if token.TokenType() == wiki.LinkToken && m.isInView(token) {
+			links = append(links, token.Id())
+		}
+	}
+	if len(links) == 0 {
+		return
+	}
+
+	m.hints = hints{active: true, background: background, labels: map[int]string{}}
+	for i, label := range hintLabels(len(links)) {
+		m.hints.labels[links[i]] = label
+	}
+}
+
+// hintLabels makes n labels of the same length, so that none of them is the
+// start of another.
+func hintLabels(n int) []string {
+	length := 1
+	for count := len(hintKeys); count < n; count *= len(hintKeys) {
+		length++
+	}
+
+	labels := make([]string, n)
+	for i := range labels {
+		label := make([]byte, length)
+		for j, k := length-1, i; j >= 0; j, k = j-1, k/len(hintKeys) {
+			label[j] = hintKeys[k%len(hintKeys)]
+		}
+		labels[i] = string(label)
+	}
+	return labels
+}
+
+func (m *Model) pushHints(input string) tea.Cmd {
+	switch input {
+	case "esc":
+		m.hints = hints{}
+		return nil
+	case "backspace":
+		if m.hints.typed != "" {
+			m.hints.typed = m.hints.typed[:len(m.hints.typed)-1]
+		}
+		return nil
+	}
+
+	typed := m.hints.typed + input
+	for id, label := range m.hints.labels {
+		if label == typed {
+			return m.followHint(id)
+		}
+		if strings.HasPrefix(label, typed) {
+			m.hints.typed = typed
+		}
+	}
+	return nil
+}
+func (m *Model) followHint(id int) tea.Cmd {
+	background := m.hints.background
+	m.hints = hints{}
+
+	token := m.document.TokenById(id)
+	if token == nil {
+		return nil
+	}
+	m.selectedToken = id
+	if background && !m.isSamePage(token.Target()) {
+		return cmd.QueueArticleWithNameCmd(token.Target())
+	}
+
+	from := m.scrollPos
+	command := m.follow(*token)
+	if m.scrollPos != from {
+		m.marks[string(JumpToMark)] = from
+	}
+	return command
+}
+
+// hintedLineView draws the labels of the links that start on a line over
+// the start of their text. Typed letters are left out, and links they do
+// not lead to are not labelled.
+func (m Model) hintedLineView(i int, l line, view string) string {
+	tokenLines := m.layout().tokenLines
+	labelled := map[int]bool{}
+	x := 0
+	for _, s := range l {
+		if s.token != nil && tokenLines[s.token.Id()] == i && !labelled[s.token.Id()] {
+			label, ok := m.hints.labels[s.token.Id()]
+			if ok && strings.HasPrefix(label, m.hints.typed) {
+				view = utils.Overlay(view, m.styles.hint.Render(label[len(m.hints.typed):]), x, 0)
+			}
+			labelled[s.token.Id()] = true
+		}
+		x += ansi.StringWidth(s.text)
+	}
+	return view
+}
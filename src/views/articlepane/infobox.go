@@ -0,0 +1,98 @@
+package articlepane
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+	"osrs.sh/wiki/ssh/src/wiki"
+)
+
+const (
+	maxCardWidth  = 48
+	maxLabelWidth = 14
+)
+
+// Infobox keys that are shown elsewhere on the card, or not at all.
+var hiddenInfoboxKeys = map[string]bool{
+	"name":    true,
+	"image":   true,
+	"version": true,
+}
+
+func (m *Model) NextVersion(_ int) {
+	m.version++
+	m.scrollPos = m.constrainScrollPos(m.scrollPos)
+}
+
+func infoboxLabel(key string) string {
+	label := strings.ReplaceAll(key, "_", " ")
+	r, size := utf8.DecodeRuneInString(label)
+	if size == 0 {
+		return ""
+	}
+	return string(unicode.ToUpper(r)) + label[size:]
+}
+
+func (m Model) infoboxCard(box *wiki.Infobox, width int) string {
+	lines := []string{}
+	if name := box.Value("name", m.version); name != "" {
+		lines = append(lines, m.styles.title.Render(name))
+	}
+	lines = append(lines, m.styles.cardLabel.Render(box.Kind))
+	if len(box.Versions) > 1 {
+		version := m.version % len(box.Versions)
+		lines = append(lines, m.styles.notice.Render(fmt.Sprintf(
+			"%s (%d/%d) · v to switch",
+			box.Versions[version], version+1, len(box.Versions),
+		)))
+	}
+	lines = append(lines, "")
+
+	keys := []string{}
+	labelWidth := 0
+	for _, key := range box.Keys {
+		if hiddenInfoboxKeys[key] || box.Value(key, m.version) == "" {
+			continue
+		}
+		keys = append(keys, key)
+		labelWidth = max(labelWidth, lipgloss.Width(infoboxLabel(key)))
+	}
+	labelWidth = min(labelWidth, maxLabelWidth) + 1
+
+	// Leave room for the border and padding.
+	valueWidth := max(width-labelWidth-4, 1)
+	for _, key := range keys {
+		lines = append(lines, lipgloss.JoinHorizontal(
+			lipgloss.Top,
+			m.styles.cardLabel.Width(labelWidth).Render(infoboxLabel(key)),
+			m.r.NewStyle().Width(valueWidth).Render(box.Value(key, m.version)),
+		))
+	}
+
+	return m.styles.card.Render(strings.Join(lines, "\n"))
+}
+
+// infoboxView renders the infoboxes of the article next to each other when
+// they fit, or below each other otherwise.
+func (m Model) infoboxView() string {
+	if len(m.document.infoboxes) == 0 {
+		return ""
+	}
+
+	width := min(m.contentWidth(), maxCardWidth)
+	cards := []string{}
+	total := 0
+	for _, box := range m.document.infoboxes {
+		card := m.infoboxCard(box, width)
+		cards = append(cards, card)
+		total += lipgloss.Width(card)
+	}
+
+	if total <= m.contentWidth() {
+		return lipgloss.JoinHorizontal(lipgloss.Top, cards...)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, cards...)
+}
@@ -0,0 +1,226 @@
+package articlepane
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+)
+
+// ActionInput is the keys that trigger an action, separated by spaces when
+// there are several. Any action can be preceded by a count.
+type ActionInput string
+
+const (
+	Up            ActionInput = "k"
+	Down          ActionInput = "j"
+	HalfPageDown  ActionInput = "ctrl+d"
+	HalfPageUp    ActionInput = "ctrl+u"
+	PageDown      ActionInput = "ctrl+f"
+	PageUp        ActionInput = "ctrl+b"
+	Top           ActionInput = "g g"
+	Bottom        ActionInput = "G"
+	NextParagraph ActionInput = "}"
+	PrevParagraph ActionInput = "{"
+	ScreenTop     ActionInput = "H"
+	ScreenMiddle  ActionInput = "M"
+	ScreenBottom  ActionInput = "L"
+	Center        ActionInput = "z z"
+	NextLink      ActionInput = "l"
+	PrevLink      ActionInput = "h"
+	Confirm       ActionInput = "enter"
+	Hint          ActionInput = "f"
+	HintQueue     ActionInput = "F"
+	Version       ActionInput = "v"
+	// Act on the first table in view.
+	TableLeft      ActionInput = "<"
+	TableRight     ActionInput = ">"
+	TableSort      ActionInput = "o"
+	Toc            ActionInput = "t"
+	NextSection    ActionInput = "] ]"
+	PrevSection    ActionInput = "[ ["
+	Search         ActionInput = "/"
+	SearchBackward ActionInput = "?"
+	NextMatch      ActionInput = "n"
+	PrevMatch      ActionInput = "N"
+	// Followed by the letter of the mark.
+	SetMark    ActionInput = "m"
+	JumpToMark ActionInput = "'"
+)
+
+func (a ActionInput) keys() []string {
+	return strings.Fields(string(a))
+}
+
+type binding struct {
+	input  ActionInput
+	action func(m *Model, n int) tea.Cmd
+	// jump is set for actions that go somewhere else in the article, which
+	// can be gone back from with ''.
+	jump bool
+}
+
+func do(action func(m *Model, n int)) func(m *Model, n int) tea.Cmd {
+	return func(m *Model, n int) tea.Cmd {
+		action(m, n)
+		return nil
+	}
+}
+
+var bindings = []binding{
+	{input: Up, action: do((*Model).ScrollUp)},
+	{input: Down, action: do((*Model).Scroll)},
+	{input: HalfPageDown, action: do((*Model).HalfPageDown)},
+	{input: HalfPageUp, action: do((*Model).HalfPageUp)},
+	{input: PageDown, action: do((*Model).PageDown)},
+	{input: PageUp, action: do((*Model).PageUp)},
+	{input: Top, action: do((*Model).ScrollToTop), jump: true},
+	{input: Bottom, action: do((*Model).ScrollTo), jump: true},
+	{input: NextParagraph, action: do((*Model).NextParagraph), jump: true},
+	{input: PrevParagraph, action: do((*Model).PrevParagraph), jump: true},
+	{input: ScreenTop, action: do((*Model).ScreenTop)},
+	{input: ScreenMiddle, action: do((*Model).ScreenMiddle)},
+	{input: ScreenBottom, action: do((*Model).ScreenBottom)},
+	{input: Center, action: do((*Model).Center)},
+	{input: NextLink, action: do((*Model).NextLink)},
+	{input: PrevLink, action: do((*Model).PrevLink)},
+	{input: Confirm, action: (*Model).Confirm, jump: true},
+	{input: Hint, action: do((*Model).StartHints)},
+	{input: HintQueue, action: do((*Model).StartBackgroundHints)},
+	{input: Version, action: do((*Model).NextVersion)},
+	{input: TableLeft, action: do((*Model).ScrollTableLeft)},
+	{input: TableRight, action: do((*Model).ScrollTableRight)},
+	{input: TableSort, action: do((*Model).SortTable)},
+	{input: Toc, action: do((*Model).ToggleToc)},
+	{input: NextSection, action: do((*Model).NextSection), jump: true},
+	{input: PrevSection, action: do((*Model).PrevSection), jump: true},
+	{input: Search, action: do((*Model).StartSearch)},
+	{input: SearchBackward, action: do((*Model).StartSearchBackward)},
+	{input: NextMatch, action: do((*Model).NextMatch), jump: true},
+	{input: PrevMatch, action: do((*Model).PrevMatch), jump: true},
+}
+
+// maxCount keeps counts from overflowing.
+const maxCount = 99999
+
+func (m *Model) Push(input string) tea.Cmd {
+	if m.search.typing {
+		m.pushSearch(input)
+		return nil
+	}
+	if m.hints.active {
+		return m.pushHints(input)
+	}
+	if m.toc.focused {
+		m.pushToc(input)
+		return nil
+	}
+	if input == "esc" {
+		if m.count == "" && len(m.keys) == 0 && m.search.query != "" {
+			m.ClearSearch()
+		}
+		m.count, m.keys = "", nil
+		return nil
+	}
+
+	if len(m.keys) == 0 && isDigit(input) && (input != "0" || m.count != "") {
+		if n, _ := strconv.Atoi(m.count + input); n <= maxCount {
+			m.count += input
+		}
+		return nil
+	}
+	m.keys = append(m.keys, input)
+	n, _ := strconv.Atoi(m.count)
+
+	log.Info("Push", "input", input, "count", m.count, "keys", m.keys)
+
+	if m.keys[0] == string(SetMark) || m.keys[0] == string(JumpToMark) {
+		if len(m.keys) == 1 {
+			return nil
+		}
+		command, mark := m.keys[0], m.keys[1]
+		m.count, m.keys = "", nil
+		switch {
+		case !validMark(mark):
+		case command == string(SetMark):
+			m.marks[mark] = m.scrollPos
+		default:
+			m.jumpToMark(mark)
+		}
+		return nil
+	}
+
+	pending := false
+	for _, b := range bindings {
+		keys := b.input.keys()
+		if slices.Equal(keys, m.keys) {
+			m.count, m.keys = "", nil
+			from := m.scrollPos
+			cmd := b.action(m, n)
+			if b.jump && m.scrollPos != from {
+				m.marks[string(JumpToMark)] = from
+			}
+			return cmd
+		}
+		if len(keys) > len(m.keys) && slices.Equal(keys[:len(m.keys)], m.keys) {
+			pending = true
+		}
+	}
+	if pending {
+		return nil
+	}
+
+	// Keys that lead nowhere are dropped, but the last one can still start
+	// something new.
+	keys := m.keys
+	m.count, m.keys = "", nil
+	if len(keys) > 1 {
+		return m.Push(input)
+	}
+	return nil
+}
+
+func isDigit(input string) bool {
+	return len(input) == 1 && input[0] >= '0' && input[0] <= '9'
+}
+
+// awaitsMark reports whether the next key is the letter of a mark.
+func (m Model) awaitsMark() bool {
+	return len(m.keys) == 1 && (m.keys[0] == string(SetMark) || m.keys[0] == string(JumpToMark))
+}
+
+// validMark reports whether a key can name a mark. ' is the position before
+// the last jump.
+func validMark(key string) bool {
+	r, size := utf8.DecodeRuneInString(key)
+	return size == len(key) && (unicode.IsLetter(r) || key == string(JumpToMark))
+}
+
+func (m *Model) jumpToMark(mark string) {
+	pos, ok := m.marks[mark]
+	if !ok {
+		return
+	}
+	m.marks[string(JumpToMark)] = m.scrollPos
+	m.scrollPos = m.constrainScrollPos(pos)
+}
+
+// pendingView shows the count and keys typed so far, while they are not an
+// action yet, or the letters of a hint.
+func (m Model) pendingView() string {
+	if m.hints.active {
+		prefix := Hint
+		if m.hints.background {
+			prefix = HintQueue
+		}
+		return m.styles.status.Render(string(prefix) + m.hints.typed)
+	}
+	if m.count == "" && len(m.keys) == 0 {
+		return ""
+	}
+	return m.styles.status.Render(m.count + strings.Join(m.keys, ""))
+}
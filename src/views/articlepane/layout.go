@@ -0,0 +1,376 @@
+package articlepane
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"osrs.sh/wiki/ssh/src/wiki"
+)
+
+// span is a run of text that is styled as a whole. Spans of a token are
+// styled when viewed, so selecting another token needs no new layout.
+type span struct {
+	text  string
+	token *wiki.DefaultToken
+	style *lipgloss.Style
+}
+
+type line []span
+
+func (l line) width() int {
+	width := 0
+	for _, s := range l {
+		width += ansi.StringWidth(s.text)
+	}
+	return width
+}
+func (l line) text() string {
+	var b strings.Builder
+	for _, s := range l {
+		b.WriteString(s.text)
+	}
+	return b.String()
+}
+func (l line) blank() bool {
+	for _, s := range l {
+		if strings.TrimSpace(s.text) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// lineRange is a range of lines, from start up to end.
+type lineRange struct {
+	start int
+	end   int
+}
+
+// layout is the article laid out for the width of the pane.
+type layout struct {
+	lines []line
+	// tokenLines is the first line of every token that is shown.
+	tokenLines map[int]int
+	tables     []lineRange
+	// matches are the matches of the search for query.
+	query   string
+	matches []searchMatch
+}
+
+// layoutCache keeps the layout of an article between frames, and its text
+// wrapped for every width it was laid out for.
+type layoutCache struct {
+	key    string
+	layout *layout
+	text   map[int][][]line
+}
+
+func newLayoutCache() *layoutCache {
+	return &layoutCache{text: map[int][][]line{}}
+}
+
+// wrap breaks spans into lines no wider than width, at spaces where
+// possible. Newlines in the spans always start a new line.
+func wrap(spans []span, width int) []line {
+	width = max(width, 1)
+	lines := []line{}
+	for _, l := range splitLines(spans) {
+		lines = append(lines, wrapLine(l, width)...)
+	}
+	return lines
+}
+
+func splitLines(spans []span) []line {
+	lines := []line{{}}
+	for _, s := range spans {
+		for i, part := range strings.Split(s.text, "\n") {
+			if i > 0 {
+				lines = append(lines, line{})
+			}
+			if part != "" {
+				lines[len(lines)-1] = append(lines[len(lines)-1], span{text: part, token: s.token, style: s.style})
+			}
+		}
+	}
+	return lines
+}
+
+// word is a run of text without spaces, with the spaces in front of it.
+type word struct {
+	space line
+	text  line
+}
+
+func words(l line) []word {
+	words := []word{}
+	cur := word{}
+	for _, s := range l {
+		for rest := s.text; rest != ""; {
+			isSpace := rest[0] == ' ' || rest[0] == '\t'
+			i := strings.IndexFunc(rest, func(r rune) bool {
+				return (r == ' ' || r == '\t') != isSpace
+			})
+			if i == -1 {
+				i = len(rest)
+			}
+			part := span{text: rest[:i], token: s.token, style: s.style}
+			rest = rest[i:]
+
+			switch {
+			case !isSpace:
+				cur.text = append(cur.text, part)
+			case len(cur.text) > 0:
+				words = append(words, cur)
+				cur = word{space: line{part}}
+			default:
+				cur.space = append(cur.space, part)
+			}
+		}
+	}
+	return append(words, cur)
+}
+
+// wrapLine wraps a line without newlines. Lines it wraps onto are indented
+// like the line itself, unless that leaves too little room.
+func wrapLine(l line, width int) []line {
+	words := words(l)
+	indent := words[0].space
+	if indent.width() > width/2 {
+		indent = nil
+	}
+
+	lines := []line{}
+	cur := line{}
+	empty := true
+	newLine := func() {
+		lines = append(lines, cur)
+		cur = append(line{}, indent...)
+		empty = true
+	}
+
+	for _, w := range words {
+		if len(w.text) == 0 {
+			if empty {
+				cur = append(cur, w.space...)
+			}
+			continue
+		}
+		switch {
+		case empty && len(lines) == 0:
+			cur = append(cur, w.space...)
+		case empty:
+		case cur.width()+w.space.width()+w.text.width() > width:
+			newLine()
+		default:
+			cur = append(cur, w.space...)
+		}
+
+		// Words wider than a line are broken anywhere.
+		text := w.text
+		for cur.width()+text.width() > width {
+			head, tail := cut(text, width-cur.width())
+			if len(head) == 0 && !empty {
+				newLine()
+				continue
+			}
+			if len(head) == 0 {
+				head, tail = firstRune(text)
+			}
+			cur = append(cur, head...)
+			text = tail
+			newLine()
+		}
+		cur = append(cur, text...)
+		empty = false
+	}
+
+	lines = append(lines, cur)
+	for i := range lines {
+		lines[i] = lines[i].merged()
+	}
+	return lines
+}
+
+// merged joins neighbouring spans that are styled the same.
+func (l line) merged() line {
+	merged := line{}
+	for _, s := range l {
+		if n := len(merged); n > 0 && merged[n-1].token == s.token && merged[n-1].style == s.style {
+			merged[n-1].text += s.text
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// cut splits a line after n cells, or before a character that does not fit.
+func cut(l line, n int) (line, line) {
+	head := line{}
+	for i, s := range l {
+		width := ansi.StringWidth(s.text)
+		if width <= n {
+			head = append(head, s)
+			n -= width
+			continue
+		}
+
+		text := ""
+		for _, r := range s.text {
+			w := ansi.StringWidth(string(r))
+			if w > n {
+				break
+			}
+			text += string(r)
+			n -= w
+		}
+		if text != "" {
+			head = append(head, span{text: text, token: s.token, style: s.style})
+		}
+		tail := append(line{{text: s.text[len(text):], token: s.token, style: s.style}}, l[i+1:]...)
+		return head, tail
+	}
+	return head, line{}
+}
+
+// firstRune splits the first character off a line, for when not even that
+// fits.
+func firstRune(l line) (line, line) {
+	s := l[0]
+	_, size := utf8.DecodeRuneInString(s.text)
+	head := line{{text: s.text[:size], token: s.token, style: s.style}}
+	if size == len(s.text) {
+		return head, l[1:]
+	}
+	return head, append(line{{text: s.text[size:], token: s.token, style: s.style}}, l[1:]...)
+}
+
+func trimBlank(lines []line) []line {
+	for len(lines) > 0 && lines[0].blank() {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1].blank() {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// textLines turns text that is already styled into lines.
+func textLines(text string) []line {
+	lines := []line{}
+	for _, l := range strings.Split(text, "\n") {
+		lines = append(lines, line{{text: l}})
+	}
+	return lines
+}
+
+// layout lays out the article for the width of the pane, which is kept
+// until the width or anything else it depends on changes.
+func (m Model) layout() *layout {
+	width := max(m.contentWidth(), 1)
+	key := fmt.Sprint(width, m.version, m.tableStates, m.notice)
+	if m.cache != nil && m.cache.layout != nil && m.cache.key == key {
+		return m.cache.layout
+	}
+
+	l := &layout{lines: []line{}, tokenLines: map[int]int{}, tables: []lineRange{}}
+	add := func(lines []line) {
+		if len(lines) == 0 {
+			return
+		}
+		if len(l.lines) > 0 {
+			l.lines = append(l.lines, line{})
+		}
+		l.lines = append(l.lines, lines...)
+	}
+
+	if m.notice != "" {
+		add(wrap([]span{{text: m.notice, style: &m.styles.notice}}, width))
+	}
+	if infobox := m.infoboxView(); infobox != "" {
+		add(textLines(infobox))
+	}
+
+	text := m.wrappedText(width)
+	for i, b := range m.document.blocks {
+		if b.table == -1 {
+			add(text[i])
+			continue
+		}
+		lines := m.tableView(b.table, width)
+		add(lines)
+		l.tables = append(l.tables, lineRange{start: len(l.lines) - len(lines), end: len(l.lines)})
+	}
+
+	for i, ln := range l.lines {
+		for _, s := range ln {
+			if s.token == nil {
+				continue
+			}
+			if _, ok := l.tokenLines[s.token.Id()]; !ok {
+				l.tokenLines[s.token.Id()] = i
+			}
+		}
+	}
+
+	if m.cache != nil {
+		m.cache.key, m.cache.layout = key, l
+	}
+	return l
+}
+
+// wrappedText returns the text blocks of the document wrapped to a width.
+func (m Model) wrappedText(width int) [][]line {
+	if m.cache != nil {
+		if text, ok := m.cache.text[width]; ok {
+			return text
+		}
+	}
+
+	text := make([][]line, len(m.document.blocks))
+	for i, b := range m.document.blocks {
+		if b.table != -1 {
+			continue
+		}
+		spans := append([]span{}, b.spans...)
+		for j, s := range spans {
+			if s.token != nil && s.token.TokenType() == wiki.PriceToken {
+				spans[j].text = m.priceText(*s.token)
+			}
+		}
+		text[i] = trimBlank(wrap(spans, width))
+	}
+
+	if m.cache != nil {
+		m.cache.text[width] = text
+	}
+	return text
+}
+
+func (m Model) lineView(l line) string {
+	var b strings.Builder
+	for _, s := range l {
+		b.WriteString(m.spanView(s))
+	}
+	return b.String()
+}
+func (m Model) spanView(s span) string {
+	if s.token == nil {
+		if s.style != nil {
+			return s.style.Render(s.text)
+		}
+		return s.text
+	}
+
+	text := s.text
+	if style := m.tokenStyles[s.token.TokenType()]; style != nil {
+		text = style.Render(text)
+		if m.selectedToken == s.token.Id() {
+			text = m.styles.selected.Render(text)
+		}
+	}
+	return m.linkedText(s.token, text)
+}
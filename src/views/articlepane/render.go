@@ -0,0 +1,411 @@
+package articlepane
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"osrs.sh/wiki/ssh/src/wiki"
+)
+
+// Hatnotes pointing readers elsewhere after a redirect, which are replaced
+// by the "Redirected from" notice.
+var hiddenTemplates = map[string]bool{
+	"redirect":  true,
+	"redirects": true,
+	"otheruses": true,
+}
+
+var bullets = []string{"•", "◦", "▪"}
+
+// Tags whose content is not shown.
+var hiddenTags = map[string]bool{
+	"gallery":      true,
+	"templatedata": true,
+	"includeonly":  true,
+}
+
+// Namespaces of links that do not point to readable articles.
+var hiddenNamespaces = map[string]bool{
+	"file":     true,
+	"image":    true,
+	"category": true,
+}
+
+// document is an article rendered to spans of text and tokens. Its tables
+// and infoboxes are kept apart, as they are laid out for the width.
+type document struct {
+	blocks    []block
+	tokens    []wiki.DefaultToken
+	infoboxes []*wiki.Infobox
+	tables    []*table
+}
+
+// block is a part of the document that is laid out on its own, which is
+// either text or the table at an index.
+type block struct {
+	spans []span
+	table int
+}
+
+func (d document) Tokens() []wiki.DefaultToken {
+	return d.tokens
+}
+func (d document) TokenById(id int) *wiki.DefaultToken {
+	if id < 0 || id >= len(d.tokens) {
+		return nil
+	}
+	return &d.tokens[id]
+}
+
+type note struct {
+	name    string
+	number  int
+	content []wiki.Node
+}
+
+// notes are the footnotes of a document, numbered in the order they are
+// first referred to.
+type notes struct {
+	list   []*note
+	byName map[string]*note
+	// listed is set when the article has a <references/> tag, and thus its
+	// own heading above the notes.
+	listed bool
+}
+
+type renderer struct {
+	spans     []span
+	blocks    []block
+	tokens    []wiki.DefaultToken
+	infoboxes []*wiki.Infobox
+	tables    []*table
+	notes     *notes
+	// drops is the drop table that {{DropsLine}} templates are added to.
+	drops *table
+	// hyperlinks is set when external links can be followed from the
+	// terminal. Otherwise their URL is added as a footnote.
+	hyperlinks bool
+}
+
+func render(doc *wiki.Document, hyperlinks bool) document {
+	r := &renderer{
+		spans:      []span{},
+		blocks:     []block{},
+		tokens:     []wiki.DefaultToken{},
+		infoboxes:  []*wiki.Infobox{},
+		tables:     []*table{},
+		notes:      &notes{list: []*note{}, byName: map[string]*note{}},
+		hyperlinks: hyperlinks,
+	}
+	r.blockNodes(doc.Children)
+	r.references()
+	return document{
+		blocks:    append(r.blocks, block{spans: r.spans, table: -1}),
+		tokens:    r.tokens,
+		infoboxes: r.infoboxes,
+		tables:    r.tables,
+	}
+}
+
+// write adds text that is not part of a token.
+func (r *renderer) write(text string) {
+	if n := len(r.spans); n > 0 && r.spans[n-1].token == nil {
+		r.spans[n-1].text += text
+		return
+	}
+	r.spans = append(r.spans, span{text: text})
+}
+
+// token adds a new token, keeping whitespace around its content outside of
+// it.
+func (r *renderer) token(tokenType wiki.WikiTokenType, text string, content string, target string) {
+	trimmed := strings.Join(strings.Fields(content), " ")
+	if trimmed == "" {
+		r.write(content)
+		return
+	}
+	if strings.TrimLeft(content, " ") != content {
+		r.write(" ")
+	}
+	token := wiki.NewToken(tokenType, text, trimmed, target, len(r.tokens))
+	r.tokens = append(r.tokens, token)
+	r.spans = append(r.spans, span{text: trimmed, token: &token})
+	if strings.TrimRight(content, " ") != content {
+		r.write(" ")
+	}
+}
+
+// tableBlock ends the text so far, as tables are laid out on their own.
+func (r *renderer) tableBlock(t *table) {
+	r.blocks = append(r.blocks, block{spans: r.spans, table: -1}, block{table: len(r.tables)})
+	r.spans = []span{}
+	r.tables = append(r.tables, t)
+}
+
+func (r *renderer) blockNodes(nodes []wiki.Node) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *wiki.Heading:
+			r.token(wiki.TitleToken, strconv.Itoa(n.Level), wiki.PlainText(n.Children), "")
+		case *wiki.Paragraph:
+			// Whitespace left by hidden templates would indent the text.
+			r.spans = append(r.spans, span{})
+			blocks, start := len(r.blocks), len(r.spans)-1
+			r.inline(n.Children)
+			// Tables in the paragraph end the text before them.
+			for i := blocks; i < len(r.blocks); i++ {
+				if r.blocks[i].table == -1 {
+					trimLeft(r.blocks[i].spans[start:])
+					start = 0
+				}
+			}
+			trimLeft(r.spans[start:])
+		case *wiki.List:
+			r.list(n, "", 0)
+		default:
+			r.inline([]wiki.Node{n})
+		}
+		r.endBlock()
+	}
+}
+
+// trimLeft trims the whitespace at the start of the text, before any token.
+func trimLeft(spans []span) {
+	for i := 0; i < len(spans) && spans[i].token == nil; i++ {
+		if spans[i].text = strings.TrimLeft(spans[i].text, " \t\n"); spans[i].text != "" {
+			break
+		}
+	}
+}
+
+// endBlock leaves an empty line after a block, unless blocks inside of it
+// already did.
+func (r *renderer) endBlock() {
+	if n := len(r.spans); n > 0 && r.spans[n-1].token == nil && strings.HasSuffix(r.spans[n-1].text, "\n\n") {
+		return
+	}
+	r.write("\n\n")
+}
+
+// list renders the items of a list below each other, where nested lists are
+// indented to line up with the text of their parent item.
+func (r *renderer) list(list *wiki.List, indent string, depth int) {
+	number := 0
+	for i, item := range list.Items {
+		if i > 0 {
+			r.write("\n")
+		}
+
+		marker := "  "
+		switch item.Marker {
+		case ';':
+			marker = ""
+		case '*':
+			marker = bullets[depth%len(bullets)] + " "
+		case '#':
+			number++
+			marker = strconv.Itoa(number) + ". "
+		}
+		if item.Marker != '#' {
+			number = 0
+		}
+
+		if len(item.Children) > 0 {
+			r.write(indent + marker)
+			if item.Marker == ';' {
+				r.formatted(item.Children, true, false)
+			} else {
+				r.inline(item.Children)
+			}
+		}
+		if item.Sublist != nil {
+			if len(item.Children) > 0 {
+				r.write("\n")
+			}
+			width := max(len([]rune(marker)), 2)
+			r.list(item.Sublist, indent+strings.Repeat(" ", width), depth+1)
+		}
+	}
+}
+
+func (r *renderer) inline(nodes []wiki.Node) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *wiki.Text:
+			r.write(n.Value)
+		case *wiki.Link:
+			r.link(n)
+		case *wiki.ExternalLink:
+			r.externalLink(n)
+		case *wiki.Formatting:
+			r.formatted(n.Children, n.Bold, n.Italic)
+		case *wiki.Template:
+			r.template(n)
+		case *wiki.Table:
+			r.tableBlock(r.table(n))
+		case *wiki.HtmlTag:
+			r.tag(n)
+		case *wiki.Price:
+			r.token(wiki.PriceToken, strconv.Itoa(n.Quantity), n.Item+" coins", n.Item)
+		case *wiki.Heading, *wiki.Paragraph, *wiki.List:
+			r.blockNodes([]wiki.Node{n})
+		}
+	}
+}
+
+func (r *renderer) template(t *wiki.Template) {
+	switch name := strings.ToLower(t.Name); {
+	case wiki.IsInfobox(t):
+		// Infoboxes are shown as cards above the article instead.
+		r.infoboxes = append(r.infoboxes, wiki.NewInfobox(t))
+	case name == "dropstablehead":
+		r.drops = r.dropsTable()
+	case name == "dropsline":
+		if r.drops == nil {
+			r.drops = r.dropsTable()
+		}
+		r.dropsLine(r.drops, wiki.NewDrop(t))
+	case name == "dropstablebottom":
+		r.drops = nil
+	case !hiddenTemplates[name]:
+		r.inline(t.Expanded)
+	}
+}
+
+func (r *renderer) link(link *wiki.Link) {
+	if hiddenNamespaces[strings.ToLower(link.Namespace())] {
+		return
+	}
+	r.token(
+		wiki.LinkToken,
+		link.Raw,
+		wiki.PlainText(link.Children),
+		strings.TrimPrefix(link.Target, ":"),
+	)
+}
+
+func (r *renderer) externalLink(link *wiki.ExternalLink) {
+	r.token(wiki.ExternalLinkToken, link.Raw, link.Label(), link.URL)
+	if r.hyperlinks || link.Label() == link.URL {
+		return
+	}
+
+	n := &note{number: len(r.notes.list) + 1, content: []wiki.Node{&wiki.ExternalLink{URL: link.URL}}}
+	r.notes.list = append(r.notes.list, n)
+	number := strconv.Itoa(n.number)
+	r.token(wiki.RefToken, "", "["+number+"]", number)
+}
+
+// formatted renders bold and italic text as a token per word, so it wraps
+// like regular text. Links inside it are kept as links.
+func (r *renderer) formatted(nodes []wiki.Node, bold bool, italic bool) {
+	tokenType := wiki.ItalicToken
+	if bold && italic {
+		tokenType = wiki.BoldItalicToken
+	} else if bold {
+		tokenType = wiki.BoldToken
+	}
+
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *wiki.Formatting:
+			r.formatted(n.Children, bold || n.Bold, italic || n.Italic)
+		case *wiki.Link:
+			r.link(n)
+		case *wiki.ExternalLink:
+			r.externalLink(n)
+		default:
+			r.words(tokenType, wiki.PlainText([]wiki.Node{n}))
+		}
+	}
+}
+
+func (r *renderer) words(tokenType wiki.WikiTokenType, text string) {
+	for text != "" {
+		i := strings.IndexFunc(text, unicode.IsSpace)
+		if i == -1 {
+			i = len(text)
+		}
+		if i == 0 {
+			_, size := utf8.DecodeRuneInString(text)
+			r.write(text[:size])
+			text = text[size:]
+			continue
+		}
+		r.token(tokenType, "", text[:i], "")
+		text = text[i:]
+	}
+}
+
+func (r *renderer) tag(tag *wiki.HtmlTag) {
+	switch {
+	case tag.Name == "br":
+		r.write("\n")
+	case tag.Name == "ref":
+		n := r.note(tag)
+		number := strconv.Itoa(n.number)
+		r.token(wiki.RefToken, tag.Raw, "["+number+"]", number)
+	case tag.Name == "references":
+		r.notes.listed = true
+		// Notes can also be defined inside the references tag.
+		for _, child := range tag.Children {
+			if ref, ok := child.(*wiki.HtmlTag); ok && ref.Name == "ref" {
+				r.note(ref)
+			}
+		}
+	case !hiddenTags[tag.Name]:
+		r.inline(tag.Children)
+	}
+}
+
+// note returns the note a ref tag refers to, which is new unless it reuses
+// the name of an earlier ref.
+func (r *renderer) note(tag *wiki.HtmlTag) *note {
+	name := tag.Attrs["name"]
+	n := r.notes.byName[name]
+	if n == nil {
+		n = &note{name: name, number: len(r.notes.list) + 1}
+		r.notes.list = append(r.notes.list, n)
+		if name != "" {
+			r.notes.byName[name] = n
+		}
+	}
+	if len(n.content) == 0 {
+		n.content = tag.Children
+	}
+	return n
+}
+
+// references renders the notes below the rest of the article.
+func (r *renderer) references() {
+	if len(r.notes.list) == 0 {
+		return
+	}
+	if !r.notes.listed {
+		r.write("\n\n")
+		r.token(wiki.TitleToken, "2", "References", "")
+	}
+	r.write("\n\n")
+	// Links in notes add notes of their own while they are listed.
+	for i := 0; i < len(r.notes.list); i++ {
+		n := r.notes.list[i]
+		number := strconv.Itoa(n.number)
+		r.token(wiki.NoteToken, "", "["+number+"]", number)
+		r.write(" ")
+		r.inline(n.content)
+		r.write("\n")
+	}
+}
+
+// plainText renders nodes as text, without any tokens.
+func (r *renderer) plainText(nodes []wiki.Node) string {
+	child := &renderer{notes: r.notes, hyperlinks: r.hyperlinks}
+	child.inline(nodes)
+	var b strings.Builder
+	for _, s := range child.spans {
+		b.WriteString(s.text)
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,268 @@
+package articlepane
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/ansi"
+	"osrs.sh/wiki/ssh/src/wiki"
+)
+
+type searchMatch struct {
+	line int
+	// start and end are byte offsets in the text of the line.
+	start int
+	end   int
+}
+
+// search is a search for text in the article, like / in vim. While typing
+// the query, every key goes to it.
+type search struct {
+	typing   bool
+	backward bool
+	query    string
+	// previous is the query before this search, and origin the line it was
+	// started at, which are restored when it is cancelled.
+	previous string
+	origin   int
+	current  int
+}
+
+// CapturesInput reports whether keys are typed into the pane, instead of
+// being shortcuts, like a query, a hint or the letter of a mark.
+func (m Model) CapturesInput() bool {
+	return m.search.typing || m.hints.active || m.awaitsMark()
+}
+
+func (m *Model) StartSearch(_ int) {
+	m.startSearch(false)
+}
+func (m *Model) StartSearchBackward(_ int) {
+	m.startSearch(true)
+}
+func (m *Model) startSearch(backward bool) {
+	m.search = search{
+		typing:   true,
+		backward: backward,
+		previous: m.search.query,
+		origin:   m.scrollPos,
+	}
+}
+
+func (m *Model) pushSearch(input string) {
+	switch input {
+	case "enter":
+		m.search.typing = false
+		if m.search.query == "" {
+			m.search.query = m.search.previous
+			m.jumpToMatch(m.search.origin, m.search.backward)
+		}
+		return
+	case "esc":
+		m.cancelSearch()
+		return
+	case "backspace":
+		if m.search.query == "" {
+			m.cancelSearch()
+			return
+		}
+		_, size := utf8.DecodeLastRuneInString(m.search.query)
+		m.search.query = m.search.query[:len(m.search.query)-size]
+	default:
+		if utf8.RuneCountInString(input) != 1 {
+			return
+		}
+		m.search.query += input
+	}
+
+	// Matches are shown while typing, starting from where the search began.
+	m.scrollPos = m.search.origin
+	m.jumpToMatch(m.search.origin, m.search.backward)
+}
+func (m *Model) cancelSearch() {
+	m.scrollPos = m.search.origin
+	m.search = search{query: m.search.previous, current: -1}
+}
+func (m *Model) ClearSearch() {
+	m.search = search{current: -1}
+}
+
+// NextMatch jumps to the next match in the direction of the search, and
+// PrevMatch in the other.
+func (m *Model) NextMatch(n int) {
+	for n = max(n, 1); n > 0; n-- {
+		m.stepMatch(m.search.backward)
+	}
+}
+func (m *Model) PrevMatch(n int) {
+	for n = max(n, 1); n > 0; n-- {
+		m.stepMatch(!m.search.backward)
+	}
+}
+func (m *Model) stepMatch(backward bool) {
+	matches := m.searchMatches()
+	if len(matches) == 0 {
+		return
+	}
+	if m.search.current < 0 || m.search.current >= len(matches) {
+		m.jumpToMatch(m.scrollPos, backward)
+		return
+	}
+	step := 1
+	if backward {
+		step = -1
+	}
+	m.search.current = (m.search.current + step + len(matches)) % len(matches)
+	m.scrollToLine(matches[m.search.current].line)
+}
+
+// jumpToMatch goes to the first match from a line on, or the last one before
+// it when searching backward, wrapping around the article.
+func (m *Model) jumpToMatch(line int, backward bool) {
+	matches := m.searchMatches()
+	m.search.current = -1
+	if len(matches) == 0 {
+		return
+	}
+
+	if backward {
+		m.search.current = len(matches) - 1
+		for i := len(matches) - 1; i >= 0; i-- {
+			if matches[i].line < line {
+				m.search.current = i
+				break
+			}
+		}
+	} else {
+		m.search.current = 0
+		for i, match := range matches {
+			if match.line >= line {
+				m.search.current = i
+				break
+			}
+		}
+	}
+	m.scrollToLine(matches[m.search.current].line)
+}
+
+// scrollToLine scrolls a line to the middle of the view, unless it is
+// already in view.
+func (m *Model) scrollToLine(line int) {
+	if line < m.scrollPos || line >= m.scrollPos+m.pageHeight() {
+		m.scrollPos = m.constrainScrollPos(line - m.pageHeight()/2)
+	}
+}
+
+// searchMatches finds the query in the text of every line, ignoring case
+// unless the query has capitals.
+func (m Model) searchMatches() []searchMatch {
+	query := m.search.query
+	if query == "" {
+		return nil
+	}
+	l := m.layout()
+	if l.matches != nil && l.query == query {
+		return l.matches
+	}
+
+	caseSensitive := strings.IndexFunc(query, unicode.IsUpper) != -1
+	if !caseSensitive {
+		query = strings.ToLower(query)
+	}
+
+	matches := []searchMatch{}
+	for i, ln := range l.lines {
+		text := ln.text()
+		if lower := strings.ToLower(text); !caseSensitive && len(lower) == len(text) {
+			text = lower
+		}
+		for start := 0; ; {
+			j := strings.Index(text[start:], query)
+			if j == -1 {
+				break
+			}
+			matches = append(matches, searchMatch{line: i, start: start + j, end: start + j + len(query)})
+			start += j + len(query)
+		}
+	}
+
+	l.query, l.matches = m.search.query, matches
+	return matches
+}
+
+// highlightedLineView shows a line with the matches of the search on it.
+func (m Model) highlightedLineView(l line, matches []searchMatch, current *searchMatch) string {
+	var b strings.Builder
+	pos := 0
+	for _, s := range l {
+		start, end := pos, pos+len(s.text)
+		pos = end
+
+		for cur := start; cur < end; {
+			var match *searchMatch
+			next := end
+			for i := range matches {
+				if matches[i].start <= cur && cur < matches[i].end {
+					match = &matches[i]
+					next = min(matches[i].end, end)
+					break
+				}
+				if matches[i].start > cur {
+					next = min(matches[i].start, end)
+					break
+				}
+			}
+
+			piece := span{text: s.text[cur-start : next-start], token: s.token, style: s.style}
+			switch {
+			case match == nil:
+				b.WriteString(m.spanView(piece))
+			case current != nil && *match == *current:
+				b.WriteString(m.linkedText(piece.token, m.styles.currentMatch.Render(piece.text)))
+			default:
+				b.WriteString(m.linkedText(piece.token, m.styles.match.Render(piece.text)))
+			}
+			cur = next
+		}
+	}
+	return b.String()
+}
+
+// linkedText makes text a hyperlink when it is part of an external link.
+func (m Model) linkedText(token *wiki.DefaultToken, text string) string {
+	if token != nil && token.TokenType() == wiki.ExternalLinkToken && m.hyperlinks {
+		return ansi.SetHyperlink(token.Target()) + text + ansi.ResetHyperlink()
+	}
+	return text
+}
+
+// searchStatus shows the query and how many matches there are, while
+// searching.
+func (m Model) searchStatus() string {
+	if !m.search.typing && m.search.query == "" {
+		return ""
+	}
+
+	prefix := "/"
+	if m.search.backward {
+		prefix = "?"
+	}
+	status := prefix + m.search.query
+	if m.search.typing {
+		status += "▏"
+	}
+
+	matches := m.searchMatches()
+	switch {
+	case m.search.query == "":
+	case len(matches) == 0:
+		status += "  no matches"
+	case m.search.current >= 0 && m.search.current < len(matches):
+		status += fmt.Sprintf("  [%d/%d]", m.search.current+1, len(matches))
+	default:
+		status += fmt.Sprintf("  [%d]", len(matches))
+	}
+	return m.styles.status.Width(max(m.width, 1)).MaxWidth(max(m.width, 1)).Render(status)
+}
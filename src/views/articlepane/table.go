@@ -0,0 +1,359 @@
+package articlepane
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"osrs.sh/wiki/ssh/src/wiki"
+)
+
+const (
+	maxColumnWidth = 32
+	maxSpan        = 64
+	columnGap      = " │ "
+)
+
+var sortNumberRegex = regexp.MustCompile(`^[+-]?[\d,]*\.?\d+`)
+
+type tableCell struct {
+	text string
+	// spans are shown instead of text when the cell has tokens.
+	spans   []span
+	header  bool
+	colspan int
+	// continued cells are covered by a rowspan from a row above, and spanned
+	// cells by a colspan from a column to their left.
+	continued bool
+	spanned   bool
+	// key is sorted by instead of text when set, and value when numeric is.
+	key     string
+	value   float64
+	numeric bool
+	// price is set for cells showing the GE value of a quantity of an item,
+	// which are filled in once prices are known.
+	price    string
+	quantity string
+}
+
+// table is a wikitable laid out as a grid, with every span expanded.
+type table struct {
+	caption    string
+	sortable   bool
+	priced     bool
+	columns    int
+	headerRows int
+	rows       [][]tableCell
+}
+
+// tableState is the horizontal scroll position and sort order of a table.
+// sort is 0 when unsorted, or 1 + twice the column index, plus 1 when
+// sorting in descending order.
+type tableState struct {
+	offset int
+	sort   int
+}
+
+func (r *renderer) table(node *wiki.Table) *table {
+	t := &table{
+		caption:  r.plainText(node.Caption),
+		sortable: node.Sortable,
+		rows:     [][]tableCell{},
+	}
+
+	// Cells still covered by a rowspan, per column.
+	pending := map[int]int{}
+	above := map[int]tableCell{}
+	fillPending := func(row []tableCell, col int) []tableCell {
+		for pending[col] > 0 {
+			pending[col]--
+			cell := above[col]
+			cell.continued = true
+			row = append(row, cell)
+			col++
+		}
+		return row
+	}
+
+	for _, nodeRow := range node.Rows {
+		row := []tableCell{}
+		for _, c := range nodeRow.Cells {
+			row = fillPending(row, len(row))
+			colspan := min(c.Colspan, maxSpan)
+			cell := tableCell{
+				text:    r.plainText(c.Children),
+				header:  c.Header,
+				colspan: colspan,
+			}
+			for i := 0; i < colspan; i++ {
+				col := len(row)
+				if c.Rowspan > 1 {
+					pending[col] = min(c.Rowspan, maxSpan) - 1
+					above[col] = cell
+				}
+				row = append(row, cell)
+				cell.spanned = true
+			}
+		}
+		for col := len(row); pending[col] > 0; col = len(row) {
+			row = fillPending(row, col)
+		}
+		if len(row) == 0 {
+			continue
+		}
+		t.rows = append(t.rows, row)
+		t.columns = max(t.columns, len(row))
+	}
+
+	for i := range t.rows {
+		for len(t.rows[i]) < t.columns {
+			t.rows[i] = append(t.rows[i], tableCell{colspan: 1})
+		}
+	}
+	for _, row := range t.rows {
+		if !isHeaderRow(row) {
+			break
+		}
+		t.headerRows++
+	}
+
+	return t
+}
+
+func isHeaderRow(row []tableCell) bool {
+	for _, cell := range row {
+		if !cell.header {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *table) sortedRows(state tableState) [][]tableCell {
+	rows := append([][]tableCell{}, t.rows[t.headerRows:]...)
+	if state.sort == 0 {
+		return rows
+	}
+
+	col := (state.sort - 1) / 2
+	descending := (state.sort-1)%2 == 1
+	sort.SliceStable(rows, func(i, j int) bool {
+		if descending {
+			return lessCell(rows[j][col], rows[i][col])
+		}
+		return lessCell(rows[i][col], rows[j][col])
+	})
+	return rows
+}
+
+// lessCell compares cells numerically when both have a value or start with
+// a number, and alphabetically otherwise.
+func lessCell(cellA, cellB tableCell) bool {
+	if cellA.numeric && cellB.numeric {
+		return cellA.value < cellB.value
+	}
+	a, b := cellA.text, cellB.text
+	if cellA.key != "" || cellB.key != "" {
+		a, b = cellA.key, cellB.key
+	}
+	na, errA := strconv.ParseFloat(strings.ReplaceAll(sortNumberRegex.FindString(a), ",", ""), 64)
+	nb, errB := strconv.ParseFloat(strings.ReplaceAll(sortNumberRegex.FindString(b), ",", ""), 64)
+	if errA == nil && errB == nil {
+		return na < nb
+	}
+	return strings.ToLower(a) < strings.ToLower(b)
+}
+
+func (t *table) columnWidths() []int {
+	widths := make([]int, t.columns)
+	for _, row := range t.rows {
+		for i, cell := range row {
+			if cell.colspan > 1 || cell.spanned {
+				continue
+			}
+			widths[i] = max(widths[i], min(lipgloss.Width(cell.text), maxColumnWidth))
+		}
+	}
+	for i := range widths {
+		widths[i] = max(widths[i], 1)
+	}
+	return widths
+}
+
+// visibleColumns returns the index after the last column that fits in the
+// width, starting at offset.
+func visibleColumns(widths []int, offset int, width int) int {
+	total := 0
+	for i := offset; i < len(widths); i++ {
+		total += widths[i]
+		if i > offset {
+			total += len([]rune(columnGap))
+		}
+		if total > width && i > offset {
+			return i
+		}
+	}
+	return len(widths)
+}
+
+func (m *Model) currentTable() int {
+	for i, lines := range m.layout().tables {
+		if lines.start < m.scrollPos+m.pageHeight() && lines.end > m.scrollPos {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Model) ScrollTableLeft(n int) {
+	if i := m.currentTable(); i != -1 {
+		m.tableStates[i].offset = max(m.tableStates[i].offset-max(n, 1), 0)
+	}
+}
+func (m *Model) ScrollTableRight(n int) {
+	i := m.currentTable()
+	if i == -1 {
+		return
+	}
+	t := m.document.tables[i]
+	state := &m.tableStates[i]
+	for n = max(n, 1); n > 0; n-- {
+		if visibleColumns(t.columnWidths(), state.offset, m.contentWidth()) >= t.columns {
+			return
+		}
+		state.offset++
+	}
+}
+
+// SortTable sorts the current table by the column of the count, or by the
+// first one. Sorting by the same column again reverses the order.
+func (m *Model) SortTable(n int) {
+	i := m.currentTable()
+	if i == -1 || !m.document.tables[i].sortable || m.document.tables[i].columns == 0 {
+		return
+	}
+	state := &m.tableStates[i]
+	col := (state.sort - 1) / 2
+	if n > 0 || state.sort == 0 {
+		col = min(max(n, 1), m.document.tables[i].columns) - 1
+	}
+	if state.sort == 1+2*col {
+		state.sort++
+	} else {
+		state.sort = 1 + 2*col
+	}
+}
+
+func (m Model) tableView(i int, width int) []line {
+	t := m.withPrices(m.document.tables[i])
+	state := m.tableStates[i]
+	caption := []line{}
+	if t.caption != "" {
+		caption = wrap([]span{{text: t.caption, style: &m.styles.notice}}, width)
+	}
+	// Tables without cells have nothing but their caption to show.
+	if t.columns == 0 {
+		return caption
+	}
+	widths := t.columnWidths()
+	for i := range widths {
+		widths[i] = min(widths[i], width)
+	}
+	offset := min(state.offset, t.columns-1)
+	end := visibleColumns(widths, offset, width)
+
+	gap := span{text: columnGap, style: &m.styles.tableBorder}
+	rowLines := func(row []tableCell) []line {
+		cells := [][]line{}
+		cellWidths := []int{}
+		for col := offset; col < end; col++ {
+			cell := row[col]
+			if cell.spanned && col > offset {
+				continue
+			}
+
+			w := widths[col]
+			for span := 1; span < cell.colspan && col+span < end; span++ {
+				w += widths[col+span] + len([]rune(columnGap))
+			}
+			spans := cell.spans
+			if spans == nil {
+				spans = []span{{text: cell.text}}
+				if cell.header {
+					spans[0].style = &m.styles.tableHeader
+				}
+			}
+			if cell.continued && state.sort == 0 || cell.spanned {
+				spans = nil
+			}
+			cells = append(cells, wrap(spans, w))
+			cellWidths = append(cellWidths, w)
+		}
+
+		height := 0
+		for _, cell := range cells {
+			height = max(height, len(cell))
+		}
+		lines := make([]line, height)
+		for k := range lines {
+			for j, cell := range cells {
+				if j > 0 {
+					lines[k] = append(lines[k], gap)
+				}
+				var l line
+				if k < len(cell) {
+					l = cell[k]
+				}
+				lines[k] = append(lines[k], l...)
+				if j < len(cells)-1 {
+					lines[k] = append(lines[k], span{text: strings.Repeat(" ", max(cellWidths[j]-l.width(), 0))})
+				}
+			}
+		}
+		return lines
+	}
+
+	lines := caption
+	for _, row := range t.rows[:t.headerRows] {
+		lines = append(lines, rowLines(row)...)
+	}
+	if t.headerRows > 0 {
+		rule := []string{}
+		for col := offset; col < end; col++ {
+			rule = append(rule, strings.Repeat("─", widths[col]))
+		}
+		lines = append(lines, line{{text: strings.Join(rule, "─┼─"), style: &m.styles.tableBorder}})
+	}
+	for _, row := range t.sortedRows(state) {
+		lines = append(lines, rowLines(row)...)
+	}
+
+	status := []string{}
+	if offset > 0 || end < t.columns {
+		status = append(status, fmt.Sprintf("columns %d–%d of %d · < > to scroll", offset+1, end, t.columns))
+	}
+	if t.sortable {
+		if state.sort == 0 {
+			status = append(status, "[n]o to sort by column n")
+		} else {
+			col := (state.sort - 1) / 2
+			direction := "↑"
+			if (state.sort-1)%2 == 1 {
+				direction = "↓"
+			}
+			label := fmt.Sprintf("column %d", col+1)
+			if t.headerRows > 0 && t.rows[t.headerRows-1][col].text != "" {
+				label = t.rows[t.headerRows-1][col].text
+			}
+			status = append(status, fmt.Sprintf("sorted by %s %s · o to reverse, [n]o to sort by column n", label, direction))
+		}
+	}
+	if len(status) > 0 {
+		lines = append(lines, wrap([]span{{text: strings.Join(status, " · "), style: &m.styles.notice}}, width)...)
+	}
+
+	return lines
+}
@@ -0,0 +1,197 @@
+package articlepane
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+	"osrs.sh/wiki/ssh/src/wiki"
+)
+
+const maxTocWidth = 32
+
+type tocEntry struct {
+	level int
+	title string
+	// token is the id of the heading the entry jumps to.
+	token int
+}
+
+// toc is the table of contents shown next to the article. While focused, it
+// takes the keys to move between its entries.
+type toc struct {
+	entries []tocEntry
+	visible bool
+	focused bool
+	cursor  int
+}
+
+// tocEntries lists the sections of a page with the heading each of them is
+// shown at. Without sections, as for pages that were not parsed by the wiki,
+// the headings of the article are used instead.
+func tocEntries(page *wiki.Page, doc document) []tocEntry {
+	headings := []wiki.DefaultToken{}
+	for _, token := range doc.Tokens() {
+		if token.TokenType() == wiki.TitleToken {
+			headings = append(headings, token)
+		}
+	}
+
+	entries := []tocEntry{}
+	if len(page.Sections) == 0 {
+		for _, heading := range headings {
+			level, _ := strconv.Atoi(heading.Text())
+			entries = append(entries, tocEntry{level: max(level-1, 1), title: heading.Content(), token: heading.Id()})
+		}
+		return entries
+	}
+
+	next := 0
+	for _, section := range page.Sections {
+		title := wiki.SectionTitle(section.Line)
+		// Sections added by templates have no heading in the wikitext.
+		for i := next; i < len(headings); i++ {
+			if wiki.NormalizeAnchor(headings[i].Content()) == wiki.NormalizeAnchor(title) {
+				entries = append(entries, tocEntry{level: max(section.TocLevel, 1), title: title, token: headings[i].Id()})
+				next = i + 1
+				break
+			}
+		}
+	}
+	return entries
+}
+
+func (m Model) tocWidth() int {
+	if !m.toc.visible {
+		return 0
+	}
+	return min(maxTocWidth, m.width/3)
+}
+
+// contentWidth is the width the article is laid out for.
+func (m Model) contentWidth() int {
+	return m.width - numberWidth - m.tocWidth()
+}
+
+// TocVisible reports whether the table of contents is shown, which is kept
+// for the next article opened.
+func (m Model) TocVisible() bool {
+	return m.toc.visible
+}
+func (m *Model) SetTocVisible(visible bool) {
+	m.toc.visible = visible
+}
+
+// ToggleToc shows and focuses the table of contents, then hides it. One with
+// no entries is never focused.
+func (m *Model) ToggleToc(_ int) {
+	switch {
+	case !m.toc.visible:
+		m.toc.visible, m.toc.focused = true, len(m.toc.entries) > 0
+		m.toc.cursor = max(m.currentSection(), 0)
+	case m.toc.focused || len(m.toc.entries) == 0:
+		m.toc.visible, m.toc.focused = false, false
+	default:
+		m.toc.focused = true
+		m.toc.cursor = max(m.currentSection(), 0)
+	}
+	m.scrollPos = m.constrainScrollPos(m.scrollPos)
+}
+
+// currentSection returns the entry of the section at the top of the view,
+// or -1 when that is still the introduction.
+func (m Model) currentSection() int {
+	current := -1
+	for i, entry := range m.toc.entries {
+		token := m.document.TokenById(entry.token)
+		if token == nil {
+			continue
+		}
+		if line, ok := m.lineFor(*token); ok && line <= m.scrollPos {
+			current = i
+		}
+	}
+	return current
+}
+
+func (m *Model) pushToc(input string) {
+	switch input {
+	case "j", "down":
+		m.toc.cursor = max(min(m.toc.cursor+1, len(m.toc.entries)-1), 0)
+	case "k", "up":
+		m.toc.cursor = max(m.toc.cursor-1, 0)
+	case "enter":
+		if m.toc.cursor >= 0 && m.toc.cursor < len(m.toc.entries) {
+			m.scrollToHeading(m.toc.entries[m.toc.cursor].token)
+		}
+		m.toc.focused = false
+	case "esc":
+		m.toc.focused = false
+	case string(Toc):
+		m.ToggleToc(0)
+	}
+}
+
+func (m *Model) scrollToHeading(id int) {
+	if token := m.document.TokenById(id); token != nil {
+		line, _ := m.lineFor(*token)
+		m.scrollPos = m.constrainScrollPos(line)
+	}
+}
+
+// headingLines returns the line of every heading in the article.
+func (m Model) headingLines() []int {
+	lines := []int{}
+	for _, token := range m.document.Tokens() {
+		if token.TokenType() != wiki.TitleToken {
+			continue
+		}
+		if line, ok := m.lineFor(token); ok {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func (m *Model) NextSection(n int) {
+	m.scrollForward(m.headingLines(), n)
+}
+func (m *Model) PrevSection(n int) {
+	m.scrollBackward(m.headingLines(), n)
+}
+
+func (m Model) tocView() string {
+	width := m.tocWidth() - m.styles.toc.GetHorizontalFrameSize()
+	lines := []string{m.styles.tocTitle.Render("Contents")}
+
+	current := m.currentSection()
+	highlighted := current
+	if m.toc.focused {
+		highlighted = m.toc.cursor
+	}
+	// Keep the highlighted entry in view on long pages.
+	height := m.pageHeight() - 1
+	start := 0
+	if len(m.toc.entries) > height {
+		start = min(max(highlighted-height/2, 0), len(m.toc.entries)-height)
+	}
+
+	for i := start; i < min(start+height, len(m.toc.entries)); i++ {
+		entry := m.toc.entries[i]
+		indent := strings.Repeat("  ", entry.level-1)
+		title := ansi.Truncate(entry.title, max(width-len(indent), 1), "…")
+		switch {
+		case m.toc.focused && i == m.toc.cursor:
+			title = m.styles.selected.Render(title)
+		case i == current:
+			title = m.styles.tocCurrent.Render(title)
+		}
+		lines = append(lines, indent+title)
+	}
+
+	return m.styles.toc.
+		Width(m.tocWidth() - m.styles.toc.GetHorizontalBorderSize() - m.styles.toc.GetHorizontalMargins()).
+		Height(m.pageHeight()).
+		MaxHeight(m.pageHeight()).
+		Render(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,169 @@
+package layout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+
+	"osrs.sh/wiki/ssh/src/cmd"
+	"osrs.sh/wiki/ssh/src/wiki"
+)
+
+type fetchKind int
+
+const (
+	searchFetch fetchKind = iota
+	searchMoreFetch
+	pageFetch
+)
+
+type fetch struct {
+	id     int
+	label  string
+	cancel context.CancelFunc
+	// waiting is set while the fetch waits out the wiki rate limit.
+	waiting bool
+}
+
+// pageLoaded is a fetched page, along with the section it was opened at.
+type pageLoaded struct {
+	page    *wiki.Page
+	section string
+}
+
+// waitingMsg is returned instead of a result while the wiki rate limit is
+// hit. Its retry keeps the id and context of the original fetch, so it is
+// still dropped when superseded in the meantime.
+type waitingMsg struct {
+	id    int
+	wait  time.Duration
+	retry tea.Cmd
+}
+
+// startFetch cancels any running fetch of the same kind and returns a
+// command running fn with a context derived from the session.
+func (m *Model) startFetch(kind fetchKind, label string, retry tea.Cmd, fn func(ctx context.Context) (tea.Msg, error)) tea.Cmd {
+	m.cancelFetch(kind)
+	m.dismissFailure()
+
+	m.fetchId++
+	id := m.fetchId
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.fetches[kind] = fetch{id: id, label: label, cancel: cancel}
+
+	var run tea.Cmd
+	run = func() tea.Msg {
+		result, err := fn(ctx)
+
+		var limited *wiki.RateLimitError
+		switch {
+		case errors.As(err, &limited):
+			return waitingMsg{id: id, wait: limited.Wait, retry: run}
+		case errors.Is(err, context.Canceled):
+			return nil
+		case err != nil:
+			log.Error("Error fetching from wiki", "err", err)
+			return cmd.FetchFailed{Id: id, Err: err, Retry: retry}
+		}
+		return cmd.FetchSucceeded{Id: id, Result: result}
+	}
+
+	return tea.Batch(
+		func() tea.Msg { return cmd.FetchStarted{Id: id, Label: label} },
+		run,
+	)
+}
+func (m *Model) cancelFetch(kinds ...fetchKind) {
+	for _, kind := range kinds {
+		if f, ok := m.fetches[kind]; ok {
+			f.cancel()
+			delete(m.fetches, kind)
+		}
+	}
+}
+
+// isCurrentFetch reports whether id belongs to a fetch that has not been
+// superseded or cancelled.
+func (m *Model) isCurrentFetch(id int) bool {
+	for _, f := range m.fetches {
+		if f.id == id {
+			return true
+		}
+	}
+	return false
+}
+func (m *Model) finishFetch(id int) {
+	for kind, f := range m.fetches {
+		if f.id == id {
+			f.cancel()
+			delete(m.fetches, kind)
+		}
+	}
+}
+func (m *Model) waitForFetch(id int) {
+	for kind, f := range m.fetches {
+		if f.id == id {
+			f.waiting = true
+			m.fetches[kind] = f
+		}
+	}
+}
+func (m *Model) fetchLabel() string {
+	for _, kind := range []fetchKind{pageFetch, searchFetch, searchMoreFetch} {
+		if f, ok := m.fetches[kind]; ok {
+			if f.waiting {
+				return "waiting for wiki…"
+			}
+			return f.label
+		}
+	}
+	return ""
+}
+
+func (m *Model) confirmSearch(query string) tea.Cmd {
+	m.cancelFetch(pageFetch, searchMoreFetch)
+	client := m.client
+	return m.startFetch(
+		searchFetch,
+		"Searching for \""+query+"\"",
+		cmd.SearchCmd(query),
+		func(ctx context.Context) (tea.Msg, error) {
+			return client.Search(ctx, query, 0, "")
+		},
+	)
+}
+func (m *Model) searchMore(msg cmd.SearchMore) tea.Cmd {
+	client := m.client
+	return m.startFetch(
+		searchMoreFetch,
+		"Loading more results",
+		cmd.SearchMoreCmd(msg.Query, msg.Offset, msg.Token),
+		func(ctx context.Context) (tea.Msg, error) {
+			return client.Search(ctx, msg.Query, msg.Offset, msg.Token)
+		},
+	)
+}
+func (m *Model) fetchPage(msg cmd.OpenArticle) tea.Cmd {
+	m.cancelFetch(searchFetch, searchMoreFetch)
+	client := m.client
+	label := "Loading page"
+	if msg.Name != "" {
+		label = "Loading " + msg.Name
+	}
+	return m.startFetch(
+		pageFetch,
+		label,
+		func() tea.Msg { return msg },
+		func(ctx context.Context) (tea.Msg, error) {
+			log.Info("MSG", "msg", msg)
+			page, err := client.ParsePage(ctx, msg)
+			if err != nil {
+				return nil, err
+			}
+			return pageLoaded{page: page, section: msg.Section}, nil
+		},
+	)
+}
@@ -0,0 +1,74 @@
+package layout
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"osrs.sh/wiki/ssh/src/views/articlepane"
+)
+
+const maxHistory = 100
+
+// historyEntry is a pane as it was left, with its page or results, scroll
+// position and selection, so going back to it restores it exactly.
+type historyEntry struct {
+	pane  contentPane
+	model tea.Model
+}
+
+// history is where the session has been, like the back and forward buttons
+// of a browser.
+type history struct {
+	back    []historyEntry
+	forward []historyEntry
+}
+
+func (m Model) currentEntry() historyEntry {
+	return historyEntry{pane: m.currentPane, model: m.panes[m.currentPane]}
+}
+
+// remember records the current pane before going somewhere new, which makes
+// anything to go forward to unreachable.
+func (m *Model) remember() {
+	if m.panes[m.currentPane] == nil {
+		return
+	}
+	m.history.back = append(m.history.back, m.currentEntry())
+	if len(m.history.back) > maxHistory {
+		m.history.back = m.history.back[1:]
+	}
+	m.history.forward = nil
+}
+
+func (m *Model) goBack() tea.Cmd {
+	if len(m.history.back) == 0 {
+		return nil
+	}
+	entry := m.history.back[len(m.history.back)-1]
+	m.history.back = m.history.back[:len(m.history.back)-1]
+	m.history.forward = append(m.history.forward, m.currentEntry())
+	return m.restore(entry)
+}
+func (m *Model) goForward() tea.Cmd {
+	if len(m.history.forward) == 0 {
+		return nil
+	}
+	entry := m.history.forward[len(m.history.forward)-1]
+	m.history.forward = m.history.forward[:len(m.history.forward)-1]
+	m.history.back = append(m.history.back, m.currentEntry())
+	return m.restore(entry)
+}
+
+// restore shows a pane from the history. Anything still loading would
+// navigate away from it again, so it is cancelled.
+func (m *Model) restore(entry historyEntry) tea.Cmd {
+	m.cancelFetch(searchFetch, searchMoreFetch, pageFetch)
+	m.dismissFailure()
+	m.panes[entry.pane] = entry.model
+	m.currentPane = entry.pane
+	m.resizePanes()
+
+	// Prices of the article may not have come in before it was left.
+	if pane, ok := entry.model.(articlepane.Model); ok && entry.pane == articlePane {
+		return m.fetchPrices(pane.PageId(), pane.PriceItems())
+	}
+	return nil
+}
@@ -1,14 +1,20 @@
 package layout
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/charmbracelet/log"
 
 	"osrs.sh/wiki/ssh/src/cmd"
 	"osrs.sh/wiki/ssh/src/style"
+	"osrs.sh/wiki/ssh/src/utils"
 	"osrs.sh/wiki/ssh/src/views/articlepane"
 	"osrs.sh/wiki/ssh/src/views/homepane"
 	"osrs.sh/wiki/ssh/src/views/searchpane"
@@ -18,12 +24,27 @@ import (
 type styles struct {
 	main         lipgloss.Style
 	contentFrame lipgloss.Style
+	banner       lipgloss.Style
+	bannerHelp   lipgloss.Style
+	loading      lipgloss.Style
+
+	dropdown           lipgloss.Style
+	suggestion         lipgloss.Style
+	selectedSuggestion lipgloss.Style
 }
 type keys struct {
-	Search key.Binding
-	Enter  key.Binding
-	Quit   key.Binding
-	Cancel key.Binding
+	Search  key.Binding
+	Enter   key.Binding
+	Quit    key.Binding
+	Cancel  key.Binding
+	Retry   key.Binding
+	Dismiss key.Binding
+	Next    key.Binding
+	Prev    key.Binding
+	// OpenQueued opens the next article that was queued.
+	OpenQueued key.Binding
+	Back       key.Binding
+	Forward    key.Binding
 }
 
 type contentPane int
@@ -34,8 +55,18 @@ const (
 	articlePane
 )
 
+// inputCapturer is a pane that can take keys as text input.
+type inputCapturer interface {
+	CapturesInput() bool
+}
+
 type Model struct {
 	r             *lipgloss.Renderer
+	ctx           context.Context
+	client        wiki.Client
+	hyperlinks    bool
+	fetches       map[fetchKind]fetch
+	fetchId       int
 	styles        styles
 	keys          keys
 	width         int
@@ -43,9 +74,18 @@ type Model struct {
 	title         string
 	showSearchBar bool
 	searchInput   textinput.Model
+	suggestions   []string
+	suggestion    int
+	suggestSeq    int
+	cancelSuggest context.CancelFunc
+	cancelPrices  context.CancelFunc
 	queryResult   *wiki.QueryResult
+	spinner       spinner.Model
+	failure       *cmd.FetchFailed
 	currentPane   contentPane
 	panes         map[contentPane]tea.Model
+	queue         []string
+	history       history
 }
 
 var DefaultKeys = keys{
@@ -65,22 +105,72 @@ var DefaultKeys = keys{
 		key.WithKeys("esc"),
 		key.WithHelp("esc", "cancel"),
 	),
+	Retry: key.NewBinding(
+		key.WithKeys("r"),
+		key.WithHelp("r", "retry"),
+	),
+	Dismiss: key.NewBinding(
+		key.WithKeys("x"),
+		key.WithHelp("x", "dismiss"),
+	),
+	Next: key.NewBinding(
+		key.WithKeys("down", "ctrl+n", "tab"),
+		key.WithHelp("↓/tab", "next suggestion"),
+	),
+	Prev: key.NewBinding(
+		key.WithKeys("up", "ctrl+p", "shift+tab"),
+		key.WithHelp("↑/shift+tab", "previous suggestion"),
+	),
+	OpenQueued: key.NewBinding(
+		key.WithKeys("ctrl+n"),
+		key.WithHelp("ctrl+n", "open queued article"),
+	),
+	Back: key.NewBinding(
+		key.WithKeys("ctrl+o", "backspace"),
+		key.WithHelp("ctrl+o", "back"),
+	),
+	// ctrl+i is sent as tab by terminals.
+	Forward: key.NewBinding(
+		key.WithKeys("tab"),
+		key.WithHelp("ctrl+i", "forward"),
+	),
 }
 
-func New(r *lipgloss.Renderer) Model {
+func New(r *lipgloss.Renderer, client wiki.Client, ctx context.Context, hyperlinks bool) Model {
 	ti := textinput.New()
 	ti.Placeholder = "Search"
 	ti.CharLimit = 64
 	ti.Width = 20
 
 	m := Model{
-		r: r,
+		r:          r,
+		ctx:        ctx,
+		client:     client,
+		hyperlinks: hyperlinks,
+		fetches:    map[fetchKind]fetch{},
 		styles: styles{
 			contentFrame: r.NewStyle().
 				Foreground(style.PrimaryForeground).
 				Border(lipgloss.NormalBorder(), true).
 				BorderForeground(style.BorderForeground).
 				Padding(0, 1),
+			banner: r.NewStyle().
+				Foreground(style.AccentForeground).
+				Bold(true).
+				Padding(0, 2),
+			bannerHelp: r.NewStyle().
+				Foreground(style.DimmedForeground),
+			loading: r.NewStyle().
+				Foreground(style.DimmedForeground),
+			dropdown: r.NewStyle().
+				Border(lipgloss.NormalBorder(), true).
+				BorderForeground(style.BorderForeground).
+				Padding(0, 1),
+			suggestion: r.NewStyle().
+				Foreground(style.PrimaryForeground),
+			selectedSuggestion: r.NewStyle().
+				Foreground(style.AccentForeground).
+				Bold(true),
 		},
 		keys: DefaultKeys,
 
@@ -91,6 +181,11 @@ func New(r *lipgloss.Renderer) Model {
 
 		showSearchBar: false,
 		searchInput:   ti,
+		suggestion:    -1,
+		spinner: spinner.New(
+			spinner.WithSpinner(spinner.Dot),
+			spinner.WithStyle(r.NewStyle().Foreground(style.AccentForeground)),
+		),
 
 		currentPane: homePane,
 		panes:       map[contentPane]tea.Model{},
@@ -106,20 +201,29 @@ func (m Model) Init() tea.Cmd {
 
 func (m Model) contentSize() (w int, h int) {
 	return m.width - m.styles.contentFrame.GetHorizontalFrameSize(),
-		m.height - m.styles.contentFrame.GetVerticalFrameSize() - lipgloss.Height(m.styles.contentFrame.Render("test"))
+		m.height - m.styles.contentFrame.GetVerticalFrameSize() - lipgloss.Height(m.styles.contentFrame.Render("test")) - lipgloss.Height(m.banner())
 
 }
 func (m *Model) resize(w int, h int) *Model {
 	m.width = w
 	m.height = h
 	m.searchInput.Width = w / 2
+	m.resizePanes()
 
+	return m
+}
+func (m *Model) resizePanes() {
 	contentW, contentH := m.contentSize()
-	if m.panes[searchPane] != nil {
-		m.panes[searchPane].(*searchpane.Model).Resize(contentW, contentH)
+	switch pane := m.panes[searchPane].(type) {
+	case searchpane.Model:
+		pane.Resize(contentW, contentH)
+		m.panes[searchPane] = pane
+	}
+	switch pane := m.panes[articlePane].(type) {
+	case articlepane.Model:
+		pane.Resize(contentW, contentH)
+		m.panes[articlePane] = pane
 	}
-
-	return m
 }
 
 func (m *Model) initPane(pane contentPane) {
@@ -131,7 +235,7 @@ func (m *Model) initPane(pane contentPane) {
 		search.Resize(w, h)
 		m.panes[pane] = search
 	case articlePane:
-		article := articlepane.New(m.r, w, h)
+		article := articlepane.New(m.r, w, h, m.hyperlinks)
 		w, h := m.contentSize()
 		article.Resize(w, h)
 		m.panes[pane] = article
@@ -145,37 +249,96 @@ func (m *Model) setPane(pane contentPane, forceNew bool) {
 	}
 	m.currentPane = pane
 }
-func (m *Model) confirmSearch(query string) tea.Cmd {
-	return func() tea.Msg {
-		result, err := wiki.Search(query)
-		if err != nil {
-			log.Error("Error searching wiki", "err", err)
-			return nil
-		}
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keys := m.keys
+	var command tea.Cmd
 
-		return result
-	}
-}
-func (m *Model) fetchPage(msg cmd.OpenArticle) tea.Cmd {
-	return func() tea.Msg {
-		log.Info("MSG", "msg", msg)
-		result, err := wiki.ParsePage(msg)
-		if err != nil {
-			log.Error("Error fetching page", "err", err)
-			return nil
+	switch msg := msg.(type) {
+	case cmd.FetchSucceeded:
+		if !m.isCurrentFetch(msg.Id) {
+			return m, nil
+		}
+		m.finishFetch(msg.Id)
+		return m.Update(msg.Result)
+	case cmd.FetchFailed:
+		if !m.isCurrentFetch(msg.Id) {
+			return m, nil
 		}
-		log.Info("Fetched page", "page", result)
-		return result
+		m.finishFetch(msg.Id)
+		m.failure = &msg
+		m.resizePanes()
+		return m, nil
+	case waitingMsg:
+		if !m.isCurrentFetch(msg.id) {
+			return m, nil
+		}
+		m.waitForFetch(msg.id)
+		return m, tea.Tick(msg.wait, func(time.Time) tea.Msg {
+			return msg.retry()
+		})
+	case cmd.FetchStarted:
+		return m, m.spinner.Tick
+	case suggestTickMsg:
+		return m, m.fetchSuggestions(msg)
+	case suggestionsMsg:
+		m.setSuggestions(msg)
+		return m, nil
+	case pricesMsg:
+		m.setPrices(msg)
+		return m, nil
+	case pricesWaitingMsg:
+		return m, tea.Tick(msg.wait, func(time.Time) tea.Msg {
+			return msg.retry()
+		})
+	case spinner.TickMsg:
+		if len(m.fetches) == 0 {
+			return m, nil
+		}
+		m.spinner, command = m.spinner.Update(msg)
+		return m, command
 	}
-}
 
-func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	keys := m.keys
-	var command tea.Cmd
+	if msg, ok := msg.(tea.KeyMsg); ok && m.searchInput.Focused() {
+		switch {
+		case msg.String() == "ctrl+c":
+			return m, tea.Quit
+		case key.Matches(msg, keys.Next):
+			m.moveSuggestion(1)
+			return m, nil
+		case key.Matches(msg, keys.Prev):
+			m.moveSuggestion(-1)
+			return m, nil
+		case key.Matches(msg, keys.Enter):
+			m.searchInput.Blur()
+			title, ok := m.selectedSuggestion()
+			m.clearSuggestions()
+			if ok {
+				m.showSearchBar = false
+				return m, cmd.OpenArticleWithNameCmd(title)
+			}
+			return m, cmd.SearchCmd(m.searchInput.Value())
+		case key.Matches(msg, keys.Cancel):
+			m.showSearchBar = false
+			m.searchInput.Blur()
+			m.clearSuggestions()
+			return m, nil
+		}
 
-	if m.searchInput.Focused() {
+		value := m.searchInput.Value()
 		m.searchInput, command = m.searchInput.Update(msg)
+		if m.searchInput.Value() != value {
+			return m, tea.Batch(command, m.queueSuggestions())
+		}
+		return m, command
 	}
+
+	// Keys typed into a pane, like a search in an article, are not
+	// shortcuts.
+	capturing := false
+	if pane, ok := m.panes[m.currentPane].(inputCapturer); ok {
+		capturing = pane.CapturesInput()
+	}
+
 	if m.panes[m.currentPane] != nil {
 		m.panes[m.currentPane], command = m.panes[m.currentPane].Update(msg)
 	}
@@ -183,33 +346,60 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		return m.resize(msg.Width, msg.Height), nil
-	case *wiki.Page:
+	case pageLoaded:
+		m.remember()
+		toc := false
+		if pane, ok := m.panes[articlePane].(articlepane.Model); ok {
+			toc = pane.TocVisible()
+		}
 		m.setPane(articlePane, true)
 		pane := m.panes[articlePane].(articlepane.Model)
-		m.panes[articlePane] = pane.SetPage(msg)
-
+		pane.SetTocVisible(toc)
+		pane = pane.SetPage(msg.page)
+		if msg.section != "" {
+			pane.ScrollToSection(msg.section)
+		}
+		m.panes[articlePane] = pane
+		return m, tea.Batch(command, m.fetchPrices(msg.page.PageID, pane.PriceItems()))
+
+	case cmd.Search:
+		m.remember()
+		m.setPane(searchPane, true)
+		return m, m.confirmSearch(msg.Query)
+	case cmd.SearchMore:
+		return m, m.searchMore(msg)
 	case cmd.OpenArticle:
 		return m, tea.Batch(
 			m.fetchPage(msg),
 		)
+	case cmd.QueueArticle:
+		m.queueArticle(msg.Name)
+		return m, command
 	case tea.KeyMsg:
 		switch {
+		case capturing:
+			if msg.String() == "ctrl+c" {
+				return m, tea.Quit
+			}
 		case key.Matches(msg, keys.Quit):
 			return m, tea.Quit
 		case key.Matches(msg, keys.Search):
 			m.showSearchBar = true
 			m.searchInput.Focus()
-		case key.Matches(msg, keys.Enter):
-			if m.searchInput.Focused() {
-				m.setPane(searchPane, true)
-				m.searchInput.Blur()
-				return m, tea.Batch(
-					m.confirmSearch(m.searchInput.Value()),
-				)
-			}
+		case key.Matches(msg, keys.OpenQueued):
+			return m, tea.Batch(command, m.openQueued())
+		case key.Matches(msg, keys.Back):
+			return m, tea.Batch(command, m.goBack())
+		case key.Matches(msg, keys.Forward):
+			return m, tea.Batch(command, m.goForward())
+		case m.failure != nil && key.Matches(msg, keys.Retry):
+			retry := m.failure.Retry
+			m.dismissFailure()
+			return m, retry
+		case m.failure != nil && key.Matches(msg, keys.Dismiss):
+			m.dismissFailure()
 		case key.Matches(msg, keys.Cancel):
 			m.showSearchBar = false
-			m.searchInput.Blur()
 		}
 
 	}
@@ -217,6 +407,51 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, command
 }
 
+func errorMessage(err error) string {
+	var wikiErr *wiki.Error
+	if !errors.As(err, &wikiErr) {
+		return "Something went wrong: " + err.Error()
+	}
+
+	switch wikiErr.Kind {
+	case wiki.NotFoundError:
+		return "That page could not be found."
+	case wiki.MissingTitleError:
+		if wikiErr.Title == "" {
+			return "No page title given."
+		}
+		return fmt.Sprintf("There is no page called %q.", wikiErr.Title)
+	case wiki.ApiError:
+		return fmt.Sprintf("The wiki returned an error (%s): %s", wikiErr.Code, wikiErr.Info)
+	case wiki.HttpStatusError:
+		return fmt.Sprintf("The wiki is unavailable (HTTP %d).", wikiErr.Status)
+	case wiki.TimeoutError:
+		return "The wiki took too long to respond."
+	}
+	return "Something went wrong: " + wikiErr.Error()
+}
+
+func (m *Model) dismissFailure() {
+	if m.failure != nil {
+		m.failure = nil
+		m.resizePanes()
+	}
+}
+func (m Model) banner() string {
+	if m.failure == nil {
+		return ""
+	}
+
+	help := m.styles.bannerHelp.Render(fmt.Sprintf(
+		"  %s %s · %s %s",
+		m.keys.Retry.Help().Key, m.keys.Retry.Help().Desc,
+		m.keys.Dismiss.Help().Key, m.keys.Dismiss.Help().Desc,
+	))
+	return m.styles.banner.
+		Width(m.width).
+		Render("✗ " + errorMessage(m.failure.Err) + help)
+}
+
 func (m Model) View() string {
 
 	topBarStyle := m.styles.contentFrame
@@ -225,6 +460,12 @@ func (m Model) View() string {
 	if m.showSearchBar {
 		topBarContent = m.searchInput.View()
 	}
+	if label := m.queueLabel(); label != "" {
+		topBarContent += "  " + m.styles.bannerHelp.Render(label)
+	}
+	if label := m.fetchLabel(); label != "" {
+		topBarContent += "  " + m.spinner.View() + m.styles.loading.Render(label)
+	}
 
 	topBar := topBarStyle.Render(
 		lipgloss.PlaceHorizontal(
@@ -238,19 +479,35 @@ func (m Model) View() string {
 	if m.panes[m.currentPane] != nil {
 		bodyContent = m.panes[m.currentPane].View()
 	}
+	banner := m.banner()
 	body := m.styles.contentFrame.Render(
 		lipgloss.Place(
 			m.width-m.styles.contentFrame.GetHorizontalFrameSize(),
-			m.height-m.styles.contentFrame.GetVerticalFrameSize()-lipgloss.Height(topBar),
+			m.height-m.styles.contentFrame.GetVerticalFrameSize()-lipgloss.Height(topBar)-lipgloss.Height(banner),
 			lipgloss.Left,
 			lipgloss.Top,
 			bodyContent,
 		),
 	)
 
-	return lipgloss.JoinVertical(
-		lipgloss.Center,
-		topBar,
-		body,
-	)
+	var view string
+	if banner == "" {
+		view = lipgloss.JoinVertical(
+			lipgloss.Center,
+			topBar,
+			body,
+		)
+	} else {
+		view = lipgloss.JoinVertical(
+			lipgloss.Center,
+			topBar,
+			banner,
+			body,
+		)
+	}
+
+	if dropdown := m.suggestionsView(); dropdown != "" {
+		view = utils.Overlay(view, dropdown, 1, lipgloss.Height(topBar))
+	}
+	return view
 }
@@ -0,0 +1,66 @@
+package layout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"osrs.sh/wiki/ssh/src/views/articlepane"
+	"osrs.sh/wiki/ssh/src/wiki"
+)
+
+type pricesMsg struct {
+	pageId int
+	prices map[string]int
+}
+
+// pricesWaitingMsg retries fetching prices once the wiki rate limit allows.
+type pricesWaitingMsg struct {
+	wait  time.Duration
+	retry tea.Cmd
+}
+
+// fetchPrices looks up the GE prices for the drop tables of an article in
+// the background. Failing to do so is not worth a banner.
+func (m *Model) fetchPrices(pageId int, items []string) tea.Cmd {
+	if m.cancelPrices != nil {
+		m.cancelPrices()
+		m.cancelPrices = nil
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.cancelPrices = cancel
+
+	client := m.client
+	var run tea.Cmd
+	run = func() tea.Msg {
+		if ctx.Err() != nil {
+			return nil
+		}
+		prices, err := client.Prices(ctx, items)
+
+		var limited *wiki.RateLimitError
+		switch {
+		case errors.As(err, &limited):
+			return pricesWaitingMsg{wait: limited.Wait, retry: run}
+		case errors.Is(err, context.Canceled):
+			return nil
+		case err != nil:
+			log.Warn("Error fetching prices", "err", err)
+			return nil
+		}
+		return pricesMsg{pageId: pageId, prices: prices}
+	}
+	return run
+}
+func (m *Model) setPrices(msg pricesMsg) {
+	pane, ok := m.panes[articlePane].(articlepane.Model)
+	if !ok || pane.PageId() != msg.pageId {
+		return
+	}
+	m.panes[articlePane] = pane.SetPrices(msg.prices)
+}
@@ -0,0 +1,34 @@
+package layout
+
+import (
+	"fmt"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"osrs.sh/wiki/ssh/src/cmd"
+)
+
+// queueArticle keeps an article that was opened in the background, to read
+// once done with the current one.
+func (m *Model) queueArticle(name string) {
+	if name != "" && !slices.Contains(m.queue, name) {
+		m.queue = append(m.queue, name)
+	}
+}
+
+// openQueued opens the article that was queued first.
+func (m *Model) openQueued() tea.Cmd {
+	if len(m.queue) == 0 {
+		return nil
+	}
+	name := m.queue[0]
+	m.queue = m.queue[1:]
+	return cmd.OpenArticleWithNameCmd(name)
+}
+
+func (m Model) queueLabel() string {
+	if len(m.queue) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d queued · %s to open", len(m.queue), m.keys.OpenQueued.Help().Key)
+}
@@ -0,0 +1,107 @@
+package layout
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+)
+
+const suggestDelay = 200 * time.Millisecond
+
+type suggestTickMsg struct {
+	seq   int
+	query string
+}
+type suggestionsMsg struct {
+	seq    int
+	titles []string
+}
+
+// queueSuggestions debounces suggestion lookups while the user is typing.
+func (m *Model) queueSuggestions() tea.Cmd {
+	m.suggestSeq++
+	seq, query := m.suggestSeq, strings.TrimSpace(m.searchInput.Value())
+	if query == "" {
+		m.clearSuggestions()
+		return nil
+	}
+
+	return tea.Tick(suggestDelay, func(time.Time) tea.Msg {
+		return suggestTickMsg{seq: seq, query: query}
+	})
+}
+func (m *Model) fetchSuggestions(msg suggestTickMsg) tea.Cmd {
+	if msg.seq != m.suggestSeq {
+		return nil
+	}
+	if m.cancelSuggest != nil {
+		m.cancelSuggest()
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.cancelSuggest = cancel
+
+	client := m.client
+	return func() tea.Msg {
+		titles, err := client.Suggest(ctx, msg.query)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Warn("Error fetching suggestions", "err", err)
+			}
+			return nil
+		}
+		return suggestionsMsg{seq: msg.seq, titles: titles}
+	}
+}
+func (m *Model) setSuggestions(msg suggestionsMsg) {
+	if msg.seq != m.suggestSeq || !m.searchInput.Focused() {
+		return
+	}
+	m.suggestions = msg.titles
+	m.suggestion = -1
+}
+func (m *Model) clearSuggestions() {
+	m.suggestSeq++
+	if m.cancelSuggest != nil {
+		m.cancelSuggest()
+		m.cancelSuggest = nil
+	}
+	m.suggestions = nil
+	m.suggestion = -1
+}
+func (m *Model) moveSuggestion(delta int) {
+	if len(m.suggestions) == 0 {
+		return
+	}
+	m.suggestion = (m.suggestion + delta + len(m.suggestions) + 1) % (len(m.suggestions) + 1)
+	if m.suggestion == len(m.suggestions) {
+		m.suggestion = -1
+	}
+}
+func (m Model) selectedSuggestion() (string, bool) {
+	if m.suggestion < 0 || m.suggestion >= len(m.suggestions) {
+		return "", false
+	}
+	return m.suggestions[m.suggestion], true
+}
+
+func (m Model) suggestionsView() string {
+	if len(m.suggestions) == 0 {
+		return ""
+	}
+
+	lines := make([]string, len(m.suggestions))
+	for i, title := range m.suggestions {
+		s := m.styles.suggestion
+		if i == m.suggestion {
+			s = m.styles.selectedSuggestion
+		}
+		lines[i] = s.Render(title)
+	}
+	return m.styles.dropdown.
+		Width(m.searchInput.Width + 4).
+		Render(strings.Join(lines, "\n"))
+}
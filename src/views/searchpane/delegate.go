@@ -0,0 +1,121 @@
+package searchpane
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"osrs.sh/wiki/ssh/src/style"
+	"osrs.sh/wiki/ssh/src/utils"
+)
+
+type delegateStyles struct {
+	items list.DefaultItemStyles
+
+	normalFrame   lipgloss.Style
+	selectedFrame lipgloss.Style
+	match         lipgloss.Style
+	selectedMatch lipgloss.Style
+	meta          lipgloss.Style
+}
+
+// delegate renders a result as its title, the highlighted snippet and a line
+// of page metadata.
+type delegate struct {
+	styles delegateStyles
+}
+
+func newDelegate(renderer *lipgloss.Renderer) delegate {
+	return delegate{
+		styles: delegateStyles{
+			items: itemStyles(renderer),
+			normalFrame: renderer.NewStyle().
+				Padding(0, 0, 0, 2),
+			selectedFrame: renderer.NewStyle().
+				Border(lipgloss.NormalBorder(), false, false, false, true).
+				BorderForeground(style.AccentForeground).
+				Padding(0, 0, 0, 1),
+			match: renderer.NewStyle().
+				Foreground(style.AccentForeground).
+				Bold(true),
+			selectedMatch: renderer.NewStyle().
+				Foreground(style.AccentForeground).
+				Bold(true).
+				Underline(true),
+			meta: renderer.NewStyle().
+				Foreground(style.SubtleForeground),
+		},
+	}
+}
+
+func (d delegate) Height() int {
+	return 3
+}
+func (d delegate) Spacing() int {
+	return 1
+}
+func (d delegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd {
+	return nil
+}
+
+func (d delegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	i, ok := listItem.(item)
+	if !ok {
+		return
+	}
+
+	s := d.styles
+	frame, title, desc, match := s.normalFrame, s.items.NormalTitle, s.items.NormalDesc, s.match
+	if index == m.Index() {
+		frame, title, desc, match = s.selectedFrame, s.items.SelectedTitle, s.items.SelectedDesc, s.selectedMatch
+	}
+	// The frame draws the border and padding, so the text styles must not.
+	title = title.UnsetBorderStyle().UnsetPadding()
+	desc = desc.UnsetBorderStyle().UnsetPadding()
+
+	width := m.Width() - frame.GetHorizontalFrameSize()
+	if width <= 0 {
+		return
+	}
+
+	snippet := ""
+	for _, span := range i.snippet {
+		if span.Match {
+			snippet += match.Render(span.Text)
+		} else {
+			snippet += desc.Render(span.Text)
+		}
+	}
+
+	lines := []string{
+		title.Render(ansi.Truncate(i.title, width, "…")),
+		ansi.Truncate(snippet, width, "…"),
+		s.meta.Render(ansi.Truncate(i.meta(), width, "…")),
+	}
+	fmt.Fprint(w, frame.Render(strings.Join(lines, "\n")))
+}
+
+func (i item) meta() string {
+	parts := []string{
+		formatSize(i.size),
+		utils.FormatNumber(i.words) + " words",
+	}
+	if !i.timestamp.IsZero() {
+		parts = append(parts, "edited "+i.timestamp.Format("2 Jan 2006"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func formatSize(bytes int) string {
+	switch {
+	case bytes >= 1000*1000:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/1000/1000)
+	case bytes >= 1000:
+		return fmt.Sprintf("%.1f kB", float64(bytes)/1000)
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
@@ -1,18 +1,27 @@
 package searchpane
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"osrs.sh/wiki/ssh/src/cmd"
 	"osrs.sh/wiki/ssh/src/style"
+	"osrs.sh/wiki/ssh/src/utils"
 	"osrs.sh/wiki/ssh/src/wiki"
 )
 
 type item struct {
-	title string
-	desc  string
-	id    int
+	title     string
+	desc      string
+	id        int
+	snippet   []wiki.SnippetSpan
+	size      int
+	words     int
+	timestamp time.Time
 }
 
 func (i item) ID() int {
@@ -29,9 +38,11 @@ func (i item) FilterValue() string {
 }
 
 type Model struct {
-	r       *lipgloss.Renderer
-	results *wiki.QueryResult
-	list    list.Model
+	r         *lipgloss.Renderer
+	results   *wiki.QueryResult
+	list      list.Model
+	header    lipgloss.Style
+	requested int
 }
 
 func itemStyles(renderer *lipgloss.Renderer) (s list.DefaultItemStyles) {
@@ -64,8 +75,7 @@ func itemStyles(renderer *lipgloss.Renderer) (s list.DefaultItemStyles) {
 }
 func New(renderer *lipgloss.Renderer, w int, h int) Model {
 	items := []list.Item{}
-	delegate := list.NewDefaultDelegate()
-	delegate.Styles = itemStyles(renderer)
+	delegate := newDelegate(renderer)
 
 	list := list.New(items, delegate, w, h)
 	list.SetShowTitle(false)
@@ -77,6 +87,9 @@ func New(renderer *lipgloss.Renderer, w int, h int) Model {
 		r:       renderer,
 		results: nil,
 		list:    list,
+		header: renderer.NewStyle().
+			Foreground(style.DimmedForeground).
+			Padding(0, 0, 1, 2),
 	}
 }
 
@@ -89,17 +102,30 @@ func (m *Model) SelectedResult() int {
 }
 
 func (m *Model) Resize(width, height int) {
-	m.list.SetSize(width, height)
+	m.list.SetSize(width, height-lipgloss.Height(m.headerView()))
 
 }
 func (m *Model) setResults(results *wiki.QueryResult) {
 	pages := results.Query.Search
 	var items []list.Item = []list.Item{}
+	if results.Offset > 0 {
+		// Copied, so the items of panes kept in the history stay as they are.
+		items = append(items, m.list.Items()...)
+	}
 	for _, result := range pages {
+		snippet := wiki.ParseSnippet(result.Snippet)
+		desc := ""
+		for _, span := range snippet {
+			desc += span.Text
+		}
 		items = append(items, item{
-			title: result.Title,
-			desc:  result.Snippet,
-			id:    result.PageID,
+			title:     result.Title,
+			desc:      desc,
+			id:        result.PageID,
+			snippet:   snippet,
+			size:      result.Size,
+			words:     result.WordCount,
+			timestamp: result.Timestamp,
 		})
 
 	}
@@ -108,6 +134,20 @@ func (m *Model) setResults(results *wiki.QueryResult) {
 	m.list.SetItems(items)
 
 }
+
+// loadMore requests the next page of results once the cursor moves past the
+// last loaded item.
+func (m *Model) loadMore() tea.Cmd {
+	if m.results == nil {
+		return nil
+	}
+	offset, token, ok := m.results.NextOffset()
+	if !ok || offset == m.requested {
+		return nil
+	}
+	m.requested = offset
+	return cmd.SearchMoreCmd(m.results.SearchQuery, offset, token)
+}
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var command tea.Cmd
 	switch msg := msg.(type) {
@@ -115,9 +155,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.results = msg
 		m.setResults(msg)
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "enter":
+		switch {
+		case msg.String() == "enter":
+			if m.list.SelectedItem() == nil {
+				return m, nil
+			}
 			return m, cmd.OpenArticleWithIdCmd(m.SelectedResult())
+		case key.Matches(msg, m.list.KeyMap.CursorDown) &&
+			m.list.Index() == len(m.list.Items())-1:
+			return m, m.loadMore()
 		}
 	}
 
@@ -126,6 +172,28 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, command
 }
 
+func (m Model) headerView() string {
+	if m.results == nil {
+		return m.header.Render("Searching…")
+	}
+
+	hits := m.results.Query.SearchInfo.TotalHits
+	noun := "results"
+	if hits == 1 {
+		noun = "result"
+	}
+	return m.header.Render(fmt.Sprintf(
+		"%s %s for \"%s\"",
+		utils.FormatNumber(hits),
+		noun,
+		m.results.SearchQuery,
+	))
+}
+
 func (m Model) View() string {
-	return m.list.View()
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		m.headerView(),
+		m.list.View(),
+	)
 }
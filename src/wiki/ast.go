@@ -0,0 +1,209 @@
+package wiki
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Node is any element of a parsed wikitext document.
+type Node interface {
+	node()
+}
+
+type Document struct {
+	Children []Node
+}
+
+type Heading struct {
+	Level    int
+	Children []Node
+}
+
+type Paragraph struct {
+	Children []Node
+}
+
+type Text struct {
+	Value string
+}
+
+type Link struct {
+	Target   string
+	Children []Node
+	Raw      string
+}
+
+// ExternalLink is a link to a URL outside the wiki, either bracketed with an
+// optional label or a bare URL in the text.
+type ExternalLink struct {
+	URL      string
+	Children []Node
+	Raw      string
+}
+
+type Template struct {
+	Name   string
+	Params []TemplateParam
+	// Expanded is what the template is shown as, see ExpandTemplate.
+	Expanded []Node
+	Raw      string
+}
+
+type TemplateParam struct {
+	// Name is the name of a named parameter, or the position of an unnamed
+	// one, starting at 1.
+	Name  string
+	Value []Node
+	Raw   string
+}
+
+type Table struct {
+	Attrs    string
+	Sortable bool
+	Caption  []Node
+	Rows     []*TableRow
+	Raw      string
+}
+
+type TableRow struct {
+	Attrs string
+	Cells []*TableCell
+}
+
+type TableCell struct {
+	Header   bool
+	Attrs    string
+	Rowspan  int
+	Colspan  int
+	Children []Node
+}
+
+type List struct {
+	Items []*ListItem
+}
+
+type ListItem struct {
+	// Marker is one of '*', '#', ';' or ':'.
+	Marker   byte
+	Children []Node
+	Sublist  *List
+}
+
+type Formatting struct {
+	Bold     bool
+	Italic   bool
+	Children []Node
+}
+
+type HtmlTag struct {
+	Name        string
+	Attrs       map[string]string
+	Children    []Node
+	SelfClosing bool
+	Raw         string
+}
+
+type Comment struct {
+	Value string
+}
+
+// Price is the Grand Exchange price of a quantity of an item, which is only
+// known once looked up.
+type Price struct {
+	Item     string
+	Quantity int
+}
+
+func (*Document) node()     {}
+func (*Heading) node()      {}
+func (*Paragraph) node()    {}
+func (*Text) node()         {}
+func (*Link) node()         {}
+func (*ExternalLink) node() {}
+func (*Template) node()     {}
+func (*Table) node()        {}
+func (*List) node()         {}
+func (*Formatting) node()   {}
+func (*HtmlTag) node()      {}
+func (*Comment) node()      {}
+func (*Price) node()        {}
+
+// Namespace returns the namespace prefix of the link target, such as "File"
+// or "Category", or an empty string for articles.
+func (l *Link) Namespace() string {
+	ns, _, found := strings.Cut(strings.TrimPrefix(l.Target, ":"), ":")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(ns)
+}
+
+// Label returns the text shown for the link, which is the URL itself when
+// it has no label.
+func (l *ExternalLink) Label() string {
+	if len(l.Children) == 0 {
+		return l.URL
+	}
+	return PlainText(l.Children)
+}
+
+func (t *Template) Param(name string) (TemplateParam, bool) {
+	for _, param := range t.Params {
+		if param.Name == name {
+			return param, true
+		}
+	}
+	return TemplateParam{}, false
+}
+
+// Arg returns the plain text value of a parameter, or an empty string when
+// it is not set.
+func (t *Template) Arg(name string) string {
+	param, ok := t.Param(name)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(PlainText(param.Value))
+}
+
+// Positional returns the plain text values of all unnamed parameters.
+func (t *Template) Positional() []string {
+	args := []string{}
+	for i := 1; ; i++ {
+		param, ok := t.Param(strconv.Itoa(i))
+		if !ok {
+			return args
+		}
+		args = append(args, strings.TrimSpace(PlainText(param.Value)))
+	}
+}
+
+// PlainText flattens nodes to their visible text, without any markup.
+func PlainText(nodes []Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *Text:
+			b.WriteString(n.Value)
+		case *Link:
+			b.WriteString(PlainText(n.Children))
+		case *ExternalLink:
+			b.WriteString(n.Label())
+		case *Formatting:
+			b.WriteString(PlainText(n.Children))
+		case *Heading:
+			b.WriteString(PlainText(n.Children))
+		case *Paragraph:
+			b.WriteString(PlainText(n.Children))
+		case *Template:
+			b.WriteString(PlainText(n.Expanded))
+		case *HtmlTag:
+			if n.Name == "br" {
+				b.WriteString("\n")
+			} else if n.Name != "ref" {
+				b.WriteString(PlainText(n.Children))
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,290 @@
+package wiki
+
+import (
+	"container/list"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/log"
+	"osrs.sh/wiki/ssh/src/cmd"
+	"osrs.sh/wiki/ssh/src/config"
+)
+
+type cacheEntry struct {
+	Page  *Page    `json:"page"`
+	Names []string `json:"names"`
+	// Redirects holds the redirects followed for each name the page was
+	// requested by, as they differ per request.
+	Redirects map[string][]Redirect `json:"redirects"`
+	FetchedAt time.Time             `json:"fetchedAt"`
+}
+
+func (e *cacheEntry) size() int {
+	size := len(e.Page.WikiText) + len(e.Page.Title)
+	for _, name := range e.Names {
+		size += len(name)
+	}
+	for _, redirects := range e.Redirects {
+		for _, r := range redirects {
+			size += len(r.From) + len(r.To) + len(r.ToFragment)
+		}
+	}
+	return size
+}
+
+// PageCache is a process-wide LRU cache of parsed pages, shared by every
+// session. Entries older than the ttl are still returned, but have to be
+// revalidated against the latest revision before being used.
+type PageCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	ttl      time.Duration
+	dir      string
+
+	size    int
+	entries *list.List
+	byId    map[int]*list.Element
+	byTitle map[string]*list.Element
+}
+
+func NewPageCache(c config.AppConfig) *PageCache {
+	cache := &PageCache{
+		maxBytes: c.PageCacheSize * 1024 * 1024,
+		ttl:      c.PageCacheTtl,
+		dir:      c.PageCacheDir,
+		entries:  list.New(),
+		byId:     map[int]*list.Element{},
+		byTitle:  map[string]*list.Element{},
+	}
+	cache.load()
+
+	return cache
+}
+
+func NormalizeTitle(title string) string {
+	title = strings.Join(strings.Fields(strings.ReplaceAll(title, "_", " ")), " ")
+	r, size := utf8.DecodeRuneInString(title)
+	if r == utf8.RuneError {
+		return title
+	}
+	return string(unicode.ToUpper(r)) + title[size:]
+}
+
+func (c *PageCache) lookup(msg cmd.OpenArticle) *list.Element {
+	if msg.PageId != 0 {
+		return c.byId[msg.PageId]
+	}
+	return c.byTitle[NormalizeTitle(msg.Name)]
+}
+
+// Get returns the cached page for msg, if any, and whether it is still
+// within its ttl.
+func (c *PageCache) Get(msg cmd.OpenArticle) (page *Page, fresh bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el := c.lookup(msg)
+	if el == nil {
+		return nil, false
+	}
+	c.entries.MoveToFront(el)
+
+	entry := el.Value.(*cacheEntry)
+	cpy := *entry.Page
+	if msg.PageId == 0 {
+		cpy.Redirects = entry.Redirects[NormalizeTitle(msg.Name)]
+	}
+	return &cpy, time.Since(entry.FetchedAt) < c.ttl
+}
+
+// Touch marks the cached revision of a page as validated.
+func (c *PageCache) Touch(pageId int) {
+	c.mu.Lock()
+	el := c.byId[pageId]
+	if el == nil {
+		c.mu.Unlock()
+		return
+	}
+	entry := el.Value.(*cacheEntry)
+	entry.FetchedAt = time.Now()
+	c.mu.Unlock()
+
+	c.persist(entry)
+}
+
+// Put stores a page under its id and title, as well as the name it was
+// requested by.
+func (c *PageCache) Put(page *Page, name string) {
+	if page == nil || page.PageID == 0 {
+		return
+	}
+
+	cpy := *page
+	cpy.Redirects = nil
+	c.mu.Lock()
+	entry := &cacheEntry{
+		Page:      &cpy,
+		Redirects: map[string][]Redirect{},
+		FetchedAt: time.Now(),
+	}
+	if el := c.byId[page.PageID]; el != nil {
+		prev := el.Value.(*cacheEntry)
+		entry.Names = prev.Names
+		for n, redirects := range prev.Redirects {
+			entry.Redirects[n] = redirects
+		}
+		c.remove(el)
+	}
+	for _, n := range []string{page.Title, name} {
+		n = NormalizeTitle(n)
+		if n != "" && !contains(entry.Names, n) {
+			entry.Names = append(entry.Names, n)
+		}
+	}
+	if name := NormalizeTitle(name); name != "" {
+		entry.Redirects[name] = page.Redirects
+	}
+	c.insert(entry)
+	evicted := c.evict()
+	c.mu.Unlock()
+
+	c.persist(entry)
+	for _, e := range evicted {
+		c.unpersist(e)
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *PageCache) insert(entry *cacheEntry) {
+	el := c.entries.PushFront(entry)
+	c.byId[entry.Page.PageID] = el
+	for _, name := range entry.Names {
+		c.byTitle[name] = el
+	}
+	c.size += entry.size()
+}
+func (c *PageCache) remove(el *list.Element) {
+	entry := el.Value.(*cacheEntry)
+	c.entries.Remove(el)
+	delete(c.byId, entry.Page.PageID)
+	for _, name := range entry.Names {
+		if c.byTitle[name] == el {
+			delete(c.byTitle, name)
+		}
+	}
+	c.size -= entry.size()
+}
+func (c *PageCache) evict() []*cacheEntry {
+	evicted := []*cacheEntry{}
+	for c.size > c.maxBytes && c.entries.Len() > 1 {
+		el := c.entries.Back()
+		evicted = append(evicted, el.Value.(*cacheEntry))
+		c.remove(el)
+	}
+	return evicted
+}
+
+func (c *PageCache) path(pageId int) string {
+	return filepath.Join(c.dir, strconv.Itoa(pageId)+".json")
+}
+func (c *PageCache) persist(entry *cacheEntry) {
+	if c.dir == "" {
+		return
+	}
+
+	c.mu.Lock()
+	data, err := json.Marshal(entry)
+	c.mu.Unlock()
+	if err != nil {
+		log.Error("cache", "err", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "page-*.tmp")
+	if err != nil {
+		log.Error("cache", "err", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(entry.Page.PageID))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Error("cache", "err", err)
+	}
+}
+func (c *PageCache) unpersist(entry *cacheEntry) {
+	if c.dir == "" {
+		return
+	}
+	if err := os.Remove(c.path(entry.Page.PageID)); err != nil && !os.IsNotExist(err) {
+		log.Error("cache", "err", err)
+	}
+}
+
+func (c *PageCache) load() {
+	if c.dir == "" {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		log.Error("cache", "err", err)
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		log.Error("cache", "err", err)
+		return
+	}
+
+	entries := []*cacheEntry{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Error("cache", "file", file, "err", err)
+			continue
+		}
+		entry := &cacheEntry{}
+		if err := json.Unmarshal(data, entry); err != nil || entry.Page == nil || entry.Page.PageID == 0 {
+			log.Warn("cache", "msg", "dropping invalid cache file", "file", file)
+			os.Remove(file)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FetchedAt.Before(entries[j].FetchedAt)
+	})
+	c.mu.Lock()
+	for _, entry := range entries {
+		c.insert(entry)
+	}
+	evicted := c.evict()
+	c.mu.Unlock()
+
+	for _, entry := range evicted {
+		c.unpersist(entry)
+	}
+	log.Info("cache", "msg", "loaded pages from disk", "count", c.entries.Len())
+}
@@ -0,0 +1,70 @@
+package wiki
+
+import (
+	"context"
+	"sync"
+)
+
+type call struct {
+	done    chan struct{}
+	body    []byte
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// group merges identical in-flight requests, so concurrent sessions asking
+// for the same url share a single round trip. The shared request is only
+// cancelled once every caller waiting on it has given up.
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+func (g *group) do(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+
+		go func() {
+			c.body, c.err = fn(callCtx)
+			g.forget(key, c)
+			close(c.done)
+			cancel()
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.body, c.err
+	case <-ctx.Done():
+		// Forgotten in the same critical section, so no new caller can join
+		// a request that is about to be cancelled.
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+			c.cancel()
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (g *group) forget(key string, c *call) {
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+}
@@ -0,0 +1,65 @@
+package wiki
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Drop is a line of a drop table, from {{DropsLine}}.
+type Drop struct {
+	Name     string
+	Quantity string
+	Rarity   string
+}
+
+var (
+	fractionRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*/\s*(\d+(?:\.\d+)?)$`)
+	quantityRegex = regexp.MustCompile(`\d+`)
+)
+
+// Rough chances of the named rarities, used to order them among fractions.
+var namedRarities = map[string]float64{
+	"always":    1,
+	"common":    1.0 / 16,
+	"uncommon":  1.0 / 64,
+	"rare":      1.0 / 512,
+	"very rare": 1.0 / 4096,
+}
+
+func NewDrop(t *Template) Drop {
+	return Drop{
+		Name:     t.Arg("name"),
+		Quantity: t.Arg("quantity"),
+		Rarity:   t.Arg("rarity"),
+	}
+}
+
+// Chance returns the rarity of the drop as a probability. It is only exact
+// for fractions like "1/512" and "Always".
+func (d Drop) Chance() (chance float64, exact bool) {
+	rarity := strings.ToLower(strings.TrimSpace(d.Rarity))
+	rarity = strings.ReplaceAll(strings.TrimPrefix(rarity, "~"), ",", "")
+
+	if match := fractionRegex.FindStringSubmatch(rarity); match != nil {
+		n, _ := strconv.ParseFloat(match[1], 64)
+		of, _ := strconv.ParseFloat(match[2], 64)
+		if of > 0 {
+			return n / of, true
+		}
+	}
+	chance, ok := namedRarities[rarity]
+	return chance, ok && chance == 1
+}
+
+// QuantityRange returns the smallest and largest quantity dropped, from
+// quantities like "5", "100-200" or "1;3;5 (noted)".
+func (d Drop) QuantityRange() (lo int, hi int, ok bool) {
+	numbers := quantityRegex.FindAllString(strings.ReplaceAll(d.Quantity, ",", ""), -1)
+	if len(numbers) == 0 {
+		return 0, 0, false
+	}
+	lo, _ = strconv.Atoi(numbers[0])
+	hi, _ = strconv.Atoi(numbers[len(numbers)-1])
+	return lo, hi, true
+}
@@ -0,0 +1,82 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+type ErrorKind int
+
+const (
+	UnknownError ErrorKind = iota
+	NotFoundError
+	MissingTitleError
+	ApiError
+	HttpStatusError
+	TimeoutError
+)
+
+type Error struct {
+	Kind ErrorKind
+	// Code and Info are set for errors reported by the MediaWiki API.
+	Code string
+	Info string
+	// Status is set for non-200 responses.
+	Status int
+	Title  string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	switch e.Kind {
+	case NotFoundError:
+		return "page not found"
+	case MissingTitleError:
+		if e.Title == "" {
+			return "missing page title"
+		}
+		return fmt.Sprintf("page %q does not exist", e.Title)
+	case ApiError:
+		return fmt.Sprintf("wiki api error %s: %s", e.Code, e.Info)
+	case HttpStatusError:
+		return fmt.Sprintf("wiki responded with %d %s", e.Status, http.StatusText(e.Status))
+	case TimeoutError:
+		return "wiki request timed out"
+	}
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return "unknown wiki error"
+}
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type apiErrorResult struct {
+	Error *struct {
+		Code string `json:"code"`
+		Info string `json:"info"`
+	} `json:"error"`
+}
+
+func errorFromCode(code string, info string) *Error {
+	kind := ApiError
+	switch code {
+	case "nosuchpageid", "nosuchrevid":
+		kind = NotFoundError
+	case "missingtitle", "invalidtitle":
+		kind = MissingTitleError
+	}
+	return &Error{Kind: kind, Code: code, Info: info}
+}
+
+func errorFromRequest(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &Error{Kind: TimeoutError, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package wiki
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Infobox is the key/value data of an infobox template, such as
+// {{Infobox Item}}. Multi-version infoboxes suffix the keys that differ per
+// version with its number, starting at 1: version1=, name2=, ...
+type Infobox struct {
+	Kind     string
+	Versions []string
+	// Keys are the parameter names without version suffix, in the order
+	// they first appear in.
+	Keys   []string
+	values map[string]string
+}
+
+func IsInfobox(t *Template) bool {
+	return strings.HasPrefix(strings.ToLower(t.Name), "infobox")
+}
+
+func NewInfobox(t *Template) *Infobox {
+	box := &Infobox{
+		Kind:     strings.TrimSpace(t.Name[len("infobox"):]),
+		Versions: []string{},
+		Keys:     []string{},
+		values:   map[string]string{},
+	}
+	for _, param := range t.Params {
+		// Parameters like "|=value" have no name to show them by.
+		if param.Name == "" {
+			continue
+		}
+		value := strings.TrimSpace(PlainText(param.Value))
+		if value == "" {
+			value = strings.TrimSpace(param.Raw)
+		}
+		box.values[strings.ToLower(param.Name)] = value
+	}
+
+	for i := 1; ; i++ {
+		version, ok := box.values["version"+strconv.Itoa(i)]
+		if !ok {
+			break
+		}
+		box.Versions = append(box.Versions, version)
+	}
+
+	for _, param := range t.Params {
+		key := strings.ToLower(param.Name)
+		if _, err := strconv.Atoi(key); err == nil || key == "" || strings.HasPrefix(key, "version") {
+			continue
+		}
+		if base, n := splitVersion(key); n > 0 && n <= len(box.Versions) {
+			key = base
+		}
+		if !contains(box.Keys, key) {
+			box.Keys = append(box.Keys, key)
+		}
+	}
+
+	return box
+}
+
+// splitVersion splits a key like "name2" into "name" and 2.
+func splitVersion(key string) (string, int) {
+	base := strings.TrimRightFunc(key, unicode.IsDigit)
+	n, err := strconv.Atoi(key[len(base):])
+	if err != nil || base == "" {
+		return key, 0
+	}
+	return base, n
+}
+
+// Value returns the value of key for a version, starting at 0, falling back
+// to the value shared by all versions.
+func (b *Infobox) Value(key string, version int) string {
+	if len(b.Versions) > 0 {
+		if value, ok := b.values[key+strconv.Itoa(version%len(b.Versions)+1)]; ok {
+			return value
+		}
+	}
+	return b.values[key]
+}
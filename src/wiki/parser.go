@@ -1,174 +1,703 @@
 package wiki
 
 import (
-	"fmt"
+	"html"
 	"regexp"
 	"strconv"
 	"strings"
-
-	"github.com/charmbracelet/lipgloss"
+	"unicode"
+	"unicode/utf8"
 )
 
-type WikiTokenType int
+// Parser is a recursive-descent parser turning wikitext into a Document.
+// Every construct that is not closed properly is kept as plain text.
+type Parser struct {
+	src string
+	pos int
+	// unclosed are the positions of constructs that were found not to be
+	// closed. They are text from then on, instead of being parsed again for
+	// everything that contains them.
+	unclosed map[int]bool
+}
 
-const (
-	TitleToken WikiTokenType = iota
-	LinkToken
-	BoldToken
-	FileToken
-	RedirectToken
+const listMarkers = "*#;:"
+
+var (
+	headingRegex   = regexp.MustCompile(`^(={1,6})(.+?)(={1,6})[ \t]*$`)
+	tagRegex       = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:\s+[^<>]*?)?)\s*(/?)>`)
+	attrRegex      = regexp.MustCompile(`([a-zA-Z_:\-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"']+))`)
+	linkTrailRegex = regexp.MustCompile(`^[a-z]+`)
+	urlRegex       = regexp.MustCompile(`^(?i)(?:https?:)?//[^\s\[\]<>"{}|]+`)
+	bareUrlRegex   = regexp.MustCompile(`^(?i)https?://[^\s\[\]<>"{}|]+`)
 )
 
-type DefaultToken struct {
-	tokenType WikiTokenType
-	text      string
-	content   string
-	target    string
-	id        int
+// Tags whose content is not wikitext.
+var rawTags = map[string]bool{
+	"nowiki":          true,
+	"pre":             true,
+	"math":            true,
+	"syntaxhighlight": true,
+	"source":          true,
+	"gallery":         true,
+	"templatedata":    true,
+}
+
+// Tags whose content can have headings, lists and paragraphs.
+var blockTags = map[string]bool{
+	"div":        true,
+	"center":     true,
+	"blockquote": true,
 }
 
-func (t DefaultToken) TokenType() WikiTokenType {
-	return t.tokenType
+// Tags that never have content or a closing tag.
+var voidTags = map[string]bool{
+	"br":  true,
+	"hr":  true,
+	"wbr": true,
+	"img": true,
 }
-func (t DefaultToken) Text() string {
-	return t.text
+
+func Parse(text string) *Document {
+	p := &Parser{src: strings.ReplaceAll(text, "\r\n", "\n")}
+	return &Document{Children: p.parseBlocks(p.eof)}
 }
-func (t DefaultToken) Content() string {
-	return t.content
+
+func parseInlineString(text string) []Node {
+	p := &Parser{src: text}
+	return p.parseInline(p.eof)
+}
+
+func (p *Parser) eof() bool {
+	return p.pos >= len(p.src)
 }
-func (t DefaultToken) Target() string {
-	return t.target
+func (p *Parser) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(p.src[p.pos:], prefix)
 }
-func (t DefaultToken) Id() int {
-	return t.id
+func (p *Parser) hasPrefixFold(prefix string) bool {
+	rest := p.src[p.pos:]
+	return len(rest) >= len(prefix) && strings.EqualFold(rest[:len(prefix)], prefix)
 }
-func (t DefaultToken) Placeholder() string {
-	if t.id == -1 {
-		return t.content
+func (p *Parser) atNewline() bool {
+	return p.hasPrefix("\n")
+}
+func (p *Parser) line() string {
+	line, _, _ := strings.Cut(p.src[p.pos:], "\n")
+	return line
+}
+func (p *Parser) skipLine() {
+	p.pos += len(p.line())
+	p.skipNewline()
+}
+func (p *Parser) skipNewline() {
+	if p.atNewline() {
+		p.pos++
+	}
+}
+func (p *Parser) skipSpaces() {
+	for p.hasPrefix(" ") || p.hasPrefix("\t") {
+		p.pos++
 	}
-	str := fmt.Sprintf("$%-*s_", len(t.Content())-1, strconv.Itoa(t.id))
-	str = strings.ReplaceAll(str, " ", "_")
-	return str
 }
 
-type Parser struct {
-	idIncr int
-	text   string
-	regex  map[WikiTokenType]*regexp.Regexp
-	tokens []DefaultToken
+// fail marks the construct at start as not closed and goes back to it.
+func (p *Parser) fail(start int) Node {
+	if p.unclosed == nil {
+		p.unclosed = map[int]bool{}
+	}
+	p.unclosed[start] = true
+	p.pos = start
+	return nil
+}
+
+func (p *Parser) quoteRun() int {
+	n := 0
+	for p.pos+n < len(p.src) && p.src[p.pos+n] == '\'' {
+		n++
+	}
+	return n
 }
 
-func NewParser(text string, styles map[WikiTokenType]*lipgloss.Style) Parser {
-	p := Parser{
-		text: text,
-		regex: map[WikiTokenType]*regexp.Regexp{
-			TitleToken:    regexp.MustCompile(`==+([a-zA-Z \-\':\(\)]+)==+`),
-			LinkToken:     regexp.MustCompile(`\[{2}(?:([\w'\+\- \(\):#]+)\|)?([\w'\- \+:\(\)]+)\]{2}`),
-			BoldToken:     regexp.MustCompile(`'''([a-zA-Z ]+)'''`),
-			FileToken:     regexp.MustCompile(`\(?\[{2}File:[a-zA-Z ]+\.[a-z]{3}(?:\|[a-zA-Z ]+)*\]{2}\)?`),
-			RedirectToken: regexp.MustCompile(`\{\{redirect\|[\w'\-\| \(\)]+\}\}`),
-		},
-		tokens: []DefaultToken{},
+// parseBlocks parses lines of headings, lists, tables and paragraphs until
+// stop reports true or the end of the input is reached.
+func (p *Parser) parseBlocks(stop func() bool) []Node {
+	nodes := []Node{}
+	var paragraph *Paragraph
+	endParagraph := func() {
+		if paragraph != nil {
+			nodes = append(nodes, paragraph)
+			paragraph = nil
+		}
+	}
+
+	atLineEnd := func() bool { return p.atNewline() || stop() }
+	for !p.eof() && !stop() {
+		line := p.line()
+		switch {
+		case strings.TrimSpace(line) == "":
+			endParagraph()
+			p.skipLine()
+		case headingRegex.MatchString(line):
+			endParagraph()
+			nodes = append(nodes, p.parseHeading())
+		case strings.HasPrefix(strings.TrimLeft(line, " \t"), "{|"):
+			endParagraph()
+			nodes = append(nodes, p.parseTable())
+		case strings.ContainsRune(listMarkers, rune(line[0])):
+			endParagraph()
+			nodes = append(nodes, p.parseList(stop))
+		case strings.HasPrefix(line, "----"):
+			endParagraph()
+			p.skipLine()
+		case isBlockTag(line):
+			endParagraph()
+			nodes = append(nodes, p.parseTag())
+		default:
+			if paragraph == nil {
+				paragraph = &Paragraph{}
+			} else {
+				paragraph.Children = append(paragraph.Children, &Text{Value: " "})
+			}
+			paragraph.Children = append(paragraph.Children, p.parseInline(atLineEnd)...)
+			p.skipNewline()
+		}
+	}
+	endParagraph()
+
+	return nodes
+}
+
+// isBlockTag reports whether a line starts with a tag like <div>, which is a
+// block of its own.
+func isBlockTag(line string) bool {
+	match := tagRegex.FindStringSubmatch(line)
+	return match != nil && match[1] == "" && blockTags[strings.ToLower(match[2])]
+}
+
+func (p *Parser) parseHeading() *Heading {
+	match := headingRegex.FindStringSubmatch(p.line())
+	p.skipLine()
+
+	level := min(len(match[1]), len(match[3]))
+	inner := strings.Repeat("=", len(match[1])-level) + match[2] + strings.Repeat("=", len(match[3])-level)
+	return &Heading{
+		Level:    level,
+		Children: trimNodes(parseInlineString(inner)),
+	}
+}
+
+func (p *Parser) parseList(stop func() bool) *List {
+	atLineEnd := func() bool { return p.atNewline() || stop() }
+	list := &List{}
+	for !p.eof() && !stop() && strings.ContainsRune(listMarkers, rune(p.src[p.pos])) {
+		prefix := p.line()[:strings.IndexFunc(p.line()+"x", func(r rune) bool {
+			return !strings.ContainsRune(listMarkers, r)
+		})]
+		p.pos += len(prefix)
+
+		if prefix[len(prefix)-1] == ';' {
+			// A term may be followed by its definition on the same line.
+			term := p.parseInline(func() bool { return atLineEnd() || p.hasPrefix(":") })
+			list.add(prefix, trimNodes(term))
+			if !p.hasPrefix(":") {
+				p.skipNewline()
+				continue
+			}
+			p.pos++
+			prefix = prefix[:len(prefix)-1] + ":"
+		}
+
+		list.add(prefix, trimNodes(p.parseInline(atLineEnd)))
+		p.skipNewline()
 	}
-	p.Parse()
+	return list
+}
 
-	return p
+// add appends an item at the depth given by the length of its prefix,
+// creating parent items for levels that were skipped.
+func (l *List) add(prefix string, children []Node) {
+	list := l
+	for i := 0; i < len(prefix)-1; i++ {
+		if len(list.Items) == 0 {
+			list.Items = append(list.Items, &ListItem{Marker: prefix[i]})
+		}
+		parent := list.Items[len(list.Items)-1]
+		if parent.Sublist == nil {
+			parent.Sublist = &List{}
+		}
+		list = parent.Sublist
+	}
+	list.Items = append(list.Items, &ListItem{
+		Marker:   prefix[len(prefix)-1],
+		Children: children,
+	})
 }
 
-func (p *Parser) newTokenForType(tokenType WikiTokenType) func(text []string) DefaultToken {
-	return func(text []string) DefaultToken {
-		id := p.idIncr
-		p.idIncr++
-		return DefaultToken{
-			tokenType: tokenType,
-			text:      text[0],
-			content:   text[1],
-			target:    "",
-			id:        id,
+func (p *Parser) parseTable() *Table {
+	start := p.pos
+	p.skipSpaces()
+	p.pos += len("{|")
+	table := &Table{Attrs: strings.TrimSpace(p.line())}
+	class := strings.Fields(parseAttrs(table.Attrs)["class"])
+	table.Sortable = contains(class, "sortable")
+	p.skipLine()
+
+	var row *TableRow
+	var cell *TableCell
+	for !p.eof() {
+		lineStart := p.pos
+		p.skipSpaces()
+		switch {
+		case p.hasPrefix("|}"):
+			p.pos += len("|}")
+			p.skipLine()
+			table.Raw = p.src[start:p.pos]
+			return table
+		case p.hasPrefix("|+"):
+			p.pos += len("|+")
+			table.Caption = trimNodes(p.parseInline(p.atNewline))
+			p.skipNewline()
+		case p.hasPrefix("|-"):
+			p.pos += len("|-")
+			row = &TableRow{Attrs: strings.TrimSpace(p.line())}
+			table.Rows = append(table.Rows, row)
+			cell = nil
+			p.skipLine()
+		case p.hasPrefix("|") || p.hasPrefix("!"):
+			header := p.hasPrefix("!")
+			p.pos++
+			if row == nil {
+				row = &TableRow{}
+				table.Rows = append(table.Rows, row)
+			}
+			cell = p.parseCells(row, header)
+		case p.hasPrefix("{|") && cell != nil:
+			cell.Children = append(cell.Children, p.parseTable())
+		case cell != nil:
+			p.pos = lineStart
+			cell.Children = append(cell.Children, &Text{Value: "\n"})
+			cell.Children = append(cell.Children, p.parseInline(p.atNewline)...)
+			p.skipNewline()
+		default:
+			p.skipLine()
 		}
 	}
+
+	table.Raw = p.src[start:p.pos]
+	return table
 }
-func (p *Parser) newHiddenTokenForType(tokenType WikiTokenType) func(text []string) DefaultToken {
-	return func(text []string) DefaultToken {
-		return DefaultToken{
-			tokenType: tokenType,
-			text:      text[0],
-			content:   "",
-			target:    "",
-			id:        -100,
+
+// parseCells parses a line of cells separated by "||", or "!!" for header
+// cells, and returns the last one.
+func (p *Parser) parseCells(row *TableRow, header bool) *TableCell {
+	atSeparator := func() bool {
+		return p.hasPrefix("||") || (header && p.hasPrefix("!!"))
+	}
+
+	var cell *TableCell
+	for {
+		cell = &TableCell{Header: header}
+		start := p.pos
+		children := p.parseInline(func() bool {
+			return p.atNewline() || atSeparator() || p.hasPrefix("|")
+		})
+		if p.hasPrefix("|") && !p.hasPrefix("||") {
+			// Everything before a single pipe are the cell's attributes.
+			cell.Attrs = strings.TrimSpace(p.src[start:p.pos])
+			p.pos++
+			children = p.parseInline(func() bool {
+				return p.atNewline() || atSeparator()
+			})
 		}
+		cell.Children = trimNodes(children)
+		attrs := parseAttrs(cell.Attrs)
+		cell.Rowspan = parseSpan(attrs["rowspan"])
+		cell.Colspan = parseSpan(attrs["colspan"])
+		row.Cells = append(row.Cells, cell)
+
+		if !atSeparator() {
+			break
+		}
+		p.pos += 2
 	}
+	p.skipNewline()
+
+	return cell
 }
-func (p *Parser) newLinkToken(text []string) DefaultToken {
-	target := text[1]
-	if target == "" {
-		target = text[2]
+
+// parseInline parses text and inline markup until stop reports true or the
+// end of the input is reached.
+func (p *Parser) parseInline(stop func() bool) []Node {
+	nodes := []Node{}
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, &Text{Value: html.UnescapeString(text.String())})
+			text.Reset()
+		}
 	}
-	id := p.idIncr
-	p.idIncr++
-	return DefaultToken{
-		tokenType: LinkToken,
-		text:      text[0],
-		content:   text[2],
-		target:    target,
-		id:        id,
+
+	for !p.eof() && !stop() {
+		var node Node
+		switch {
+		case p.hasPrefix("<!--"):
+			node = p.parseComment()
+		case p.hasPrefix("{{{"):
+			node = p.parseTemplateArgument()
+		case p.hasPrefix("{{"):
+			node = p.parseTemplate()
+		case p.hasPrefix("[["):
+			node = p.parseLink()
+		case p.hasPrefix("["):
+			node = p.parseExternalLink()
+		case p.hasPrefixFold("http"):
+			node = p.parseBareUrl()
+		case p.hasPrefix("''"):
+			node = p.parseFormatting(stop)
+		case p.hasPrefix("<"):
+			node = p.parseTag()
+		}
+
+		if node != nil {
+			flush()
+			nodes = append(nodes, node)
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		text.WriteRune(r)
+		p.pos += size
 	}
+	flush()
+
+	return nodes
 }
 
-func (p *Parser) matchesForRegex(reg *regexp.Regexp, text string, fn func(s []string) DefaultToken) []DefaultToken {
-	var tokens []DefaultToken = []DefaultToken{}
-	matches := reg.FindAllStringSubmatch(text, -1)
-	for _, match := range matches {
-		tokens = append(tokens, fn(match))
+func (p *Parser) parseComment() Node {
+	p.pos += len("<!--")
+	end := strings.Index(p.src[p.pos:], "-->")
+	if end == -1 {
+		end = len(p.src) - p.pos
 	}
+	comment := &Comment{Value: p.src[p.pos : p.pos+end]}
+	p.pos = min(len(p.src), p.pos+end+len("-->"))
 
-	return tokens
+	return comment
 }
-func (p *Parser) Tokens() []DefaultToken {
-	return p.tokens
+
+// parseTemplateArgument keeps "{{{name|default}}}" as plain text, as there
+// are no arguments to substitute outside of templates.
+func (p *Parser) parseTemplateArgument() Node {
+	end := strings.Index(p.src[p.pos:], "}}}")
+	if end == -1 {
+		return nil
+	}
+	text := &Text{Value: p.src[p.pos : p.pos+end+len("}}}")]}
+	p.pos += end + len("}}}")
+
+	return text
 }
-func (p *Parser) TokenById(id int) *DefaultToken {
-	for _, token := range p.tokens {
-		if token.Id() == id {
-			return &token
+
+func (p *Parser) parseTemplate() Node {
+	start := p.pos
+	if p.unclosed[start] {
+		return nil
+	}
+	p.pos += len("{{")
+
+	atParamEnd := func() bool { return p.hasPrefix("|") || p.hasPrefix("}}") }
+	name := p.parseInline(atParamEnd)
+	template := &Template{Name: strings.TrimSpace(PlainText(name))}
+
+	index := 1
+	for p.hasPrefix("|") {
+		p.pos++
+
+		param := TemplateParam{}
+		if end := p.paramNameEnd(); end != -1 {
+			param.Name = strings.TrimSpace(p.src[p.pos:end])
+			p.pos = end + 1
+		} else {
+			param.Name = strconv.Itoa(index)
+			index++
 		}
+
+		valueStart := p.pos
+		param.Value = trimNodes(p.parseInline(atParamEnd))
+		param.Raw = p.src[valueStart:p.pos]
+		template.Params = append(template.Params, param)
 	}
-	return nil
+
+	if !p.hasPrefix("}}") {
+		return p.fail(start)
+	}
+	p.pos += len("}}")
+	template.Raw = p.src[start:p.pos]
+	template.Expanded = ExpandTemplate(template)
+
+	return template
 }
-func (p *Parser) TokenByPlaceholder(str string) *DefaultToken {
-	for _, token := range p.tokens {
-		if token.Placeholder() == str {
-			return &token
+
+// paramNameEnd returns the position of the "=" ending a parameter name, or
+// -1 if the parameter at the current position is unnamed.
+func (p *Parser) paramNameEnd() int {
+	for i := p.pos; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '=':
+			return i
+		case '|', '}', '{', '[', '<', '\n':
+			return -1
 		}
 	}
-	return nil
+	return -1
+}
+
+func (p *Parser) parseLink() Node {
+	start := p.pos
+	if p.unclosed[start] {
+		return nil
+	}
+	p.pos += len("[[")
+
+	targetStart := p.pos
+	for !p.hasPrefix("|") && !p.hasPrefix("]]") {
+		if p.eof() || p.atNewline() || p.hasPrefix("[[") || p.hasPrefix("{{") {
+			return p.fail(start)
+		}
+		p.pos++
+	}
+	link := &Link{Target: strings.TrimSpace(p.src[targetStart:p.pos])}
+
+	if p.hasPrefix("|") {
+		p.pos++
+		link.Children = trimNodes(p.parseInline(func() bool { return p.hasPrefix("]]") || p.atNewline() }))
+		if !p.hasPrefix("]]") {
+			return p.fail(start)
+		}
+	}
+	p.pos += len("]]")
+
+	if len(link.Children) == 0 {
+		link.Children = []Node{&Text{Value: strings.TrimPrefix(link.Target, ":")}}
+	}
+	if trail := linkTrailRegex.FindString(p.src[p.pos:]); trail != "" {
+		link.Children = append(link.Children, &Text{Value: trail})
+		p.pos += len(trail)
+	}
+	link.Raw = p.src[start:p.pos]
+
+	return link
+}
+
+func (p *Parser) parseExternalLink() Node {
+	start := p.pos
+	if p.unclosed[start] {
+		return nil
+	}
+	p.pos += len("[")
+
+	url := urlRegex.FindString(p.src[p.pos:])
+	if url == "" {
+		p.pos = start
+		return nil
+	}
+	p.pos += len(url)
+	link := &ExternalLink{URL: url}
+
+	if !p.hasPrefix("]") {
+		p.skipSpaces()
+		link.Children = trimNodes(p.parseInline(func() bool {
+			return p.hasPrefix("]") || p.atNewline()
+		}))
+	}
+	if !p.hasPrefix("]") {
+		return p.fail(start)
+	}
+	p.pos += len("]")
+	link.Raw = p.src[start:p.pos]
+
+	return link
 }
 
-func (p *Parser) Parse() {
-	tokens := []DefaultToken{}
-	for tokenType, regex := range p.regex {
-		var fn func(s []string) DefaultToken
-		switch tokenType {
-		case LinkToken:
-			fn = p.newLinkToken
-		case FileToken, RedirectToken:
-			fn = p.newHiddenTokenForType(tokenType)
+// parseBareUrl parses a URL in running text. Punctuation at its end is taken
+// to be part of the sentence instead.
+func (p *Parser) parseBareUrl() Node {
+	if p.pos > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(p.src[:p.pos]); unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return nil
+		}
+	}
+	url := bareUrlRegex.FindString(p.src[p.pos:])
+	for len(url) > 0 && strings.ContainsRune(".,;:!?)'", rune(url[len(url)-1])) {
+		if url[len(url)-1] == ')' && strings.Contains(url, "(") {
+			break
+		}
+		url = url[:len(url)-1]
+	}
+	if url == "" || strings.HasSuffix(url, "//") {
+		return nil
+	}
+	p.pos += len(url)
+
+	return &ExternalLink{URL: url, Raw: url}
+}
+
+// parseFormatting parses bold and italic text. Like MediaWiki, formatting
+// that is not closed ends at the end of the line.
+func (p *Parser) parseFormatting(stop func() bool) Node {
+	run := p.quoteRun()
+	switch {
+	case run == 4 || run > 5:
+		// The first apostrophes are literal text.
+		return nil
+	case run == 5:
+		return p.parseBoldItalic(stop)
+	}
+
+	p.pos += run
+	children := p.parseInline(func() bool {
+		return p.quoteRun() == run || p.atNewline() || stop()
+	})
+	if p.quoteRun() == run {
+		p.pos += run
+	}
+
+	return &Formatting{
+		Bold:     run == 3,
+		Italic:   run == 2,
+		Children: children,
+	}
+}
+
+// parseBoldItalic parses text opened with five apostrophes, which may be
+// closed in one go or by closing bold and italic separately.
+func (p *Parser) parseBoldItalic(stop func() bool) Node {
+	p.pos += 5
+	atQuotes := func() bool {
+		run := p.quoteRun()
+		return run == 2 || run == 3 || run == 5
+	}
+	children := p.parseInline(func() bool {
+		return atQuotes() || p.atNewline() || stop()
+	})
+
+	closed := p.quoteRun()
+	if closed != 2 && closed != 3 {
+		if closed == 5 {
+			p.pos += 5
+		}
+		return &Formatting{Bold: true, Italic: true, Children: children}
+	}
+
+	p.pos += closed
+	inner := &Formatting{Bold: closed == 3, Italic: closed == 2, Children: children}
+	remaining := 5 - closed
+	rest := p.parseInline(func() bool {
+		return p.quoteRun() == remaining || p.atNewline() || stop()
+	})
+	if p.quoteRun() == remaining {
+		p.pos += remaining
+	}
+
+	return &Formatting{
+		Bold:     remaining == 3,
+		Italic:   remaining == 2,
+		Children: append([]Node{inner}, rest...),
+	}
+}
+
+func (p *Parser) parseTag() Node {
+	match := tagRegex.FindStringSubmatch(p.src[p.pos:])
+	if match == nil || match[1] == "/" {
+		if match != nil {
+			// Stray closing tags are dropped.
+			p.pos += len(match[0])
+			return &Comment{}
+		}
+		return nil
+	}
+
+	start := p.pos
+	p.pos += len(match[0])
+	tag := &HtmlTag{
+		Name:  strings.ToLower(match[2]),
+		Attrs: parseAttrs(match[3]),
+	}
+	if match[4] == "/" || voidTags[tag.Name] {
+		tag.SelfClosing = true
+		tag.Raw = match[0]
+		return tag
+	}
+
+	closing := "</" + tag.Name
+	if rawTags[tag.Name] {
+		end := strings.Index(strings.ToLower(p.src[p.pos:]), closing)
+		if end == -1 {
+			end = len(p.src) - p.pos
+		}
+		tag.Children = []Node{&Text{Value: p.src[p.pos : p.pos+end]}}
+		p.pos += end
+	} else {
+		atClosing := func() bool { return p.hasPrefixFold(closing) }
+		switch {
+		case p.unclosed[start]:
+		case blockTags[tag.Name]:
+			tag.Children = p.parseBlocks(atClosing)
 		default:
-			fn = p.newTokenForType(tokenType)
+			tag.Children = p.parseInline(atClosing)
 		}
+		if p.unclosed[start] || p.eof() {
+			// Without a closing tag, the tag is treated as empty.
+			p.fail(start)
+			p.pos = start + len(match[0])
+			tag.Children = nil
+			tag.Raw = match[0]
+			return tag
+		}
+	}
 
-		p.text = regex.ReplaceAllStringFunc(p.text, func(s string) string {
-			match := regex.FindAllStringSubmatch(s, -1)[0]
-			if match == nil {
-				return s
-			}
-			token := fn(match)
-			tokens = append(tokens, token)
-			return token.Placeholder()
-		})
+	if end := strings.Index(p.src[p.pos:], ">"); end != -1 {
+		p.pos += end + 1
+	}
+	tag.Raw = p.src[start:p.pos]
+
+	return tag
+}
+
+// parseSpan parses a rowspan or colspan attribute, which defaults to 1.
+func parseSpan(s string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+func parseAttrs(s string) map[string]string {
+	attrs := map[string]string{}
+	for _, match := range attrRegex.FindAllStringSubmatch(s, -1) {
+		attrs[strings.ToLower(match[1])] = match[2] + match[3] + match[4]
 	}
-	p.tokens = tokens
+	return attrs
 }
-func (p *Parser) Text() string {
-	return p.text
+
+// trimNodes trims leading and trailing whitespace of the outer text nodes.
+func trimNodes(nodes []Node) []Node {
+	if len(nodes) == 0 {
+		return nodes
+	}
+	if text, ok := nodes[0].(*Text); ok {
+		nodes[0] = &Text{Value: strings.TrimLeft(text.Value, " \t\n")}
+	}
+	if text, ok := nodes[len(nodes)-1].(*Text); ok {
+		nodes[len(nodes)-1] = &Text{Value: strings.TrimRight(text.Value, " \t\n")}
+	}
+
+	trimmed := []Node{}
+	for _, n := range nodes {
+		if text, ok := n.(*Text); ok && text.Value == "" {
+			continue
+		}
+		trimmed = append(trimmed, n)
+	}
+	return trimmed
 }
@@ -0,0 +1,46 @@
+package wiki
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Constructs that are not closed must not be parsed again for every
+// construct around them, which takes exponential time when they are nested.
+func TestParseUnclosedIsFast(t *testing.T) {
+	for _, open := range []string{"<div>", "{{a|", "[[a|", "[http://a ", "<span>"} {
+		text := strings.Repeat(open+"x ", 200)
+		start := time.Now()
+		Parse(text)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("parsing %d unclosed %q took %s", 200, open, elapsed)
+		}
+	}
+}
+
+func TestParseBlockTag(t *testing.T) {
+	doc := Parse("Intro.\n<div>\n==Heading==\n* item\n</div>\nAfter.")
+	if len(doc.Children) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(doc.Children))
+	}
+	tag, ok := doc.Children[1].(*HtmlTag)
+	if !ok || tag.Name != "div" || len(tag.Children) != 2 {
+		t.Fatalf("got %#v, want a div with a heading and a list", doc.Children[1])
+	}
+	if _, ok := tag.Children[0].(*Heading); !ok {
+		t.Errorf("got %#v, want a heading", tag.Children[0])
+	}
+	if _, ok := tag.Children[1].(*List); !ok {
+		t.Errorf("got %#v, want a list", tag.Children[1])
+	}
+}
+
+func TestParseLinkLabelEndsAtNewline(t *testing.T) {
+	doc := Parse("[[a|b\n]]")
+	for _, n := range doc.Children[0].(*Paragraph).Children {
+		if _, ok := n.(*Link); ok {
+			t.Errorf("got a link, want text")
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package wiki
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+type SnippetSpan struct {
+	Text  string
+	Match bool
+}
+
+var (
+	searchMatchRegex = regexp.MustCompile(`<span class="searchmatch">(.*?)</span>`)
+	htmlTagRegex     = regexp.MustCompile(`<[^>]*>`)
+)
+
+func snippetText(s string) string {
+	s = html.UnescapeString(htmlTagRegex.ReplaceAllString(s, ""))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// ParseSnippet turns the html of a search snippet into plain text spans,
+// marking the ones the search matched.
+func ParseSnippet(snippet string) []SnippetSpan {
+	spans := []SnippetSpan{}
+	add := func(text string, match bool) {
+		if text == "" {
+			return
+		}
+		if len(spans) > 0 && spans[len(spans)-1].Match == match {
+			spans[len(spans)-1].Text += text
+			return
+		}
+		spans = append(spans, SnippetSpan{Text: text, Match: match})
+	}
+
+	last := 0
+	for _, loc := range searchMatchRegex.FindAllStringSubmatchIndex(snippet, -1) {
+		add(spaced(snippet[last:loc[0]]), false)
+		add(snippetText(snippet[loc[2]:loc[3]]), true)
+		last = loc[1]
+	}
+	add(spaced(snippet[last:]), false)
+
+	if len(spans) > 0 {
+		spans[0].Text = strings.TrimLeft(spans[0].Text, " ")
+		spans[len(spans)-1].Text = strings.TrimRight(spans[len(spans)-1].Text, " ")
+	}
+	return spans
+}
+
+// spaced converts s like snippetText, but keeps a single leading and
+// trailing space, which separate it from neighbouring matches.
+func spaced(s string) string {
+	text := snippetText(s)
+	if text == "" {
+		if strings.TrimSpace(s) != s && s != "" {
+			return " "
+		}
+		return ""
+	}
+	if strings.TrimLeft(s, " \n\t") != s {
+		text = " " + text
+	}
+	if strings.TrimRight(s, " \n\t") != s {
+		text += " "
+	}
+	return text
+}
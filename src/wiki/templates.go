@@ -0,0 +1,134 @@
+package wiki
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"osrs.sh/wiki/ssh/src/utils"
+)
+
+// TemplateFunc expands a template into the nodes it should be shown as.
+type TemplateFunc func(t *Template) []Node
+
+var (
+	templatesMu sync.RWMutex
+	templates   = map[string]TemplateFunc{}
+)
+
+// RegisterTemplate sets the function used to expand templates with the
+// given name, replacing any earlier one. Names are case-insensitive.
+func RegisterTemplate(name string, fn TemplateFunc, aliases ...string) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+
+	for _, n := range append([]string{name}, aliases...) {
+		templates[templateKey(n)] = fn
+	}
+}
+
+func templateKey(name string) string {
+	return strings.ToLower(NormalizeTitle(name))
+}
+
+// ExpandTemplate returns the nodes a template expands to. Templates without
+// a registered function are shown as the text of their unnamed parameters.
+func ExpandTemplate(t *Template) []Node {
+	templatesMu.RLock()
+	fn := templates[templateKey(t.Name)]
+	templatesMu.RUnlock()
+
+	if fn != nil {
+		return fn(t)
+	}
+
+	nodes := []Node{}
+	for _, param := range t.Params {
+		if _, err := strconv.Atoi(param.Name); err != nil {
+			continue
+		}
+		if len(nodes) > 0 {
+			nodes = append(nodes, &Text{Value: " "})
+		}
+		nodes = append(nodes, param.Value...)
+	}
+	return nodes
+}
+
+func text(s string) []Node {
+	return []Node{&Text{Value: s}}
+}
+func link(target string, label string) *Link {
+	if label == "" {
+		label = target
+	}
+	return &Link{Target: target, Children: text(label)}
+}
+
+func init() {
+	empty := func(*Template) []Node { return []Node{} }
+	RegisterTemplate("External", empty)
+	RegisterTemplate("Clear", empty)
+
+	RegisterTemplate("Coins", func(t *Template) []Node {
+		amount := t.Arg("1")
+		if n, err := strconv.Atoi(strings.ReplaceAll(amount, ",", "")); err == nil {
+			amount = utils.FormatNumber(n)
+		}
+		return text(amount + " coins")
+	})
+	RegisterTemplate("SCP", func(t *Template) []Node {
+		skill, level := t.Arg("1"), t.Arg("2")
+		if level == "" {
+			return []Node{link(skill, "")}
+		}
+		return []Node{&Text{Value: level + " "}, link(skill, "")}
+	}, "Skill clickpic")
+	RegisterTemplate("Members", func(t *Template) []Node {
+		if strings.EqualFold(t.Arg("1"), "no") {
+			return text("Free-to-play")
+		}
+		return text("Members")
+	})
+	RegisterTemplate("plink", func(t *Template) []Node {
+		return []Node{link(t.Arg("1"), t.Arg("txt"))}
+	}, "plinkp", "plinkt")
+	RegisterTemplate("GEP", func(t *Template) []Node {
+		quantity, err := strconv.Atoi(t.Arg("2"))
+		if err != nil {
+			quantity = 1
+		}
+		return []Node{&Price{Item: t.Arg("1"), Quantity: quantity}}
+	}, "GEPrice")
+	RegisterTemplate("NA", func(t *Template) []Node {
+		if note := t.Arg("1"); note != "" {
+			return text("N/A (" + note + ")")
+		}
+		return text("N/A")
+	})
+	RegisterTemplate("*", func(t *Template) []Node {
+		return text(" • ")
+	})
+	RegisterTemplate("Main", func(t *Template) []Node {
+		nodes := text("Main article: ")
+		for i, target := range t.Positional() {
+			if i > 0 {
+				nodes = append(nodes, &Text{Value: ", "})
+			}
+			nodes = append(nodes, link(target, ""))
+		}
+		return nodes
+	})
+	RegisterTemplate("Cite web", func(t *Template) []Node {
+		parts := []string{}
+		for _, name := range []string{"author", "title", "date"} {
+			if arg := t.Arg(name); arg != "" {
+				parts = append(parts, arg)
+			}
+		}
+		return text(strings.Join(parts, ". "))
+	}, "Cite tweet", "Cite news", "Cite forum", "Cite video", "Cite book")
+	RegisterTemplate("Citation needed", func(t *Template) []Node {
+		return text("[citation needed]")
+	}, "cn", "Fact")
+}
@@ -0,0 +1,55 @@
+package wiki
+
+type WikiTokenType int
+
+const (
+	// TitleToken is a heading, with its level as text.
+	TitleToken WikiTokenType = iota
+	LinkToken
+	BoldToken
+	ItalicToken
+	BoldItalicToken
+	// RefToken is a footnote marker in the text, and NoteToken the marker
+	// in front of its note. Both target the number of the note.
+	RefToken
+	NoteToken
+	// PriceToken is the GE price of the item it targets, times the quantity
+	// in its text.
+	PriceToken
+	// ExternalLinkToken is a link outside the wiki, targeting its URL.
+	ExternalLinkToken
+)
+
+type DefaultToken struct {
+	tokenType WikiTokenType
+	text      string
+	content   string
+	target    string
+	id        int
+}
+
+func NewToken(tokenType WikiTokenType, text string, content string, target string, id int) DefaultToken {
+	return DefaultToken{
+		tokenType: tokenType,
+		text:      text,
+		content:   content,
+		target:    target,
+		id:        id,
+	}
+}
+
+func (t DefaultToken) TokenType() WikiTokenType {
+	return t.tokenType
+}
+func (t DefaultToken) Text() string {
+	return t.text
+}
+func (t DefaultToken) Content() string {
+	return t.content
+}
+func (t DefaultToken) Target() string {
+	return t.target
+}
+func (t DefaultToken) Id() int {
+	return t.id
+}
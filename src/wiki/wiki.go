@@ -1,23 +1,55 @@
 package wiki
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"html"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"osrs.sh/wiki/ssh/src/cmd"
+	"osrs.sh/wiki/ssh/src/config"
 )
 
 type QueryResult struct {
+	Continue *struct {
+		SrOffset int    `json:"sroffset"`
+		Continue string `json:"continue"`
+	} `json:"continue"`
 	Query struct {
-		Search []struct {
-			Title   string `json:"title"`
-			PageID  int    `json:"pageid"`
-			Snippet string `json:"snippet"`
-		} `json:"search"`
+		SearchInfo struct {
+			TotalHits int `json:"totalhits"`
+		} `json:"searchinfo"`
+		Search []SearchResult `json:"search"`
 	} `json:"query"`
+
+	// SearchQuery and Offset are the parameters the result was requested with.
+	SearchQuery string `json:"-"`
+	Offset      int    `json:"-"`
+}
+
+type SearchResult struct {
+	Title     string    `json:"title"`
+	PageID    int       `json:"pageid"`
+	Snippet   string    `json:"snippet"`
+	Size      int       `json:"size"`
+	WordCount int       `json:"wordcount"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// NextOffset returns the offset of the next page of results, if there is one,
+// along with the continue token to request it with.
+func (r *QueryResult) NextOffset() (int, string, bool) {
+	if r.Continue == nil {
+		return 0, "", false
+	}
+	return r.Continue.SrOffset, r.Continue.Continue, true
 }
 
 type ParseResult struct {
@@ -26,6 +58,7 @@ type ParseResult struct {
 type Page struct {
 	Title      string `json:"title"`
 	PageID     int    `json:"pageid"`
+	RevId      int    `json:"revid"`
 	Categories []struct {
 		Category string `json:"category"`
 	} `json:"categories"`
@@ -34,61 +67,356 @@ type Page struct {
 		Level    string `json:"level"`
 		Line     string `json:"line"`
 		Index    string `json:"index"`
+		Anchor   string `json:"anchor"`
 	} `json:"sections"`
-	WikiText string `json:"wikitext"`
+	WikiText  string     `json:"wikitext"`
+	Redirects []Redirect `json:"redirects"`
+}
+
+type Redirect struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	ToFragment string `json:"tofragment"`
+}
+
+// RedirectedFrom returns the title that was requested when it redirected to
+// this page, and the section the redirect points to, if any.
+func (p *Page) RedirectedFrom() (from string, fragment string) {
+	if len(p.Redirects) == 0 {
+		return "", ""
+	}
+	return p.Redirects[0].From, p.Redirects[len(p.Redirects)-1].ToFragment
+}
+
+// NormalizeAnchor turns a section anchor or heading into a comparable form,
+// as links may use spaces or underscores and encode special characters.
+func NormalizeAnchor(anchor string) string {
+	if unescaped, err := url.PathUnescape(anchor); err == nil {
+		anchor = unescaped
+	}
+	return strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(anchor, "_", " ")), " "))
+}
+
+// SectionTitle returns the text of a section line, which can contain HTML.
+func SectionTitle(line string) string {
+	return html.UnescapeString(htmlTagRegex.ReplaceAllString(line, ""))
+}
+
+// Section finds the heading an anchor links to. As headings are not unique,
+// it also returns how many earlier headings have the same text.
+func (p *Page) Section(anchor string) (heading string, occurrence int, ok bool) {
+	anchor = NormalizeAnchor(anchor)
+	for i, section := range p.Sections {
+		if NormalizeAnchor(section.Anchor) != anchor {
+			continue
+		}
+		heading = SectionTitle(section.Line)
+		for _, earlier := range p.Sections[:i] {
+			if earlier.Line == section.Line {
+				occurrence++
+			}
+		}
+		return heading, occurrence, true
+	}
+	return "", 0, false
+}
+
+type RevisionResult struct {
+	Query struct {
+		Pages []struct {
+			PageID    int `json:"pageid"`
+			Revisions []struct {
+				RevId int `json:"revid"`
+			} `json:"revisions"`
+		} `json:"pages"`
+	} `json:"query"`
+}
+
+type ExpandResult struct {
+	ExpandTemplates struct {
+		WikiText string `json:"wikitext"`
+	} `json:"expandtemplates"`
+}
+
+const (
+	searchLimit  = 20
+	suggestLimit = 8
+)
+
+type Client interface {
+	Search(ctx context.Context, query string, offset int, token string) (*QueryResult, error)
+	ParsePage(ctx context.Context, msg cmd.OpenArticle) (*Page, error)
+	Suggest(ctx context.Context, prefix string) ([]string, error)
+	Prices(ctx context.Context, items []string) (map[string]int, error)
+}
+
+type HttpClient struct {
+	baseUrl   string
+	userAgent string
+	http      *http.Client
+	cache     *PageCache
+	limiter   *RateLimiter
+	inflight  group
+}
+
+type ClientOption func(c *HttpClient)
+
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *HttpClient) {
+		c.http.Transport = transport
+	}
+}
+
+func WithPageCache(cache *PageCache) ClientOption {
+	return func(c *HttpClient) {
+		c.cache = cache
+	}
 }
 
-func getHttpClient() *http.Client {
-	return &http.Client{
-		Timeout: time.Second * 10,
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(c *HttpClient) {
+		c.limiter = limiter
 	}
 }
 
-func searchUrl(query string) string {
-	baseUrl := "https://oldschool.runescape.wiki/api.php?action=query&format=json&list=search&redirects=1&formatversion=2&srprop=size%7Cwordcount%7Ctimestamp%7Csnippet"
-	searchParam := "srsearch=" + query
-	return baseUrl + "&" + searchParam
+func NewClient(c config.AppConfig, opts ...ClientOption) *HttpClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = c.WikiMaxConns
+
+	client := &HttpClient{
+		baseUrl:   c.WikiApiUrl,
+		userAgent: c.WikiUserAgent,
+		http: &http.Client{
+			Timeout:   c.WikiTimeout,
+			Transport: transport,
+		},
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client
 }
-func Search(query string) (*QueryResult, error) {
-	log.Info("wiki", "query", query)
 
-	client := getHttpClient()
+func (c *HttpClient) get(ctx context.Context, url string, v any) error {
+	body, err := c.inflight.do(ctx, url, func(ctx context.Context) ([]byte, error) {
+		if wait := c.limiter.Take(); wait > 0 {
+			return nil, &RateLimitError{Wait: wait}
+		}
+		return c.fetch(ctx, url)
+	})
+	if err != nil {
+		return err
+	}
+
+	apiErr := apiErrorResult{}
+	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Error != nil {
+		return errorFromCode(apiErr.Error.Code, apiErr.Error.Info)
+	}
 
-	res, err := client.Get(searchUrl(query))
+	return json.Unmarshal(body, v)
+}
+func (c *HttpClient) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, errorFromRequest(err)
+	}
 
 	defer res.Body.Close()
 
+	if res.StatusCode != http.StatusOK {
+		return nil, &Error{Kind: HttpStatusError, Status: res.StatusCode}
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, errorFromRequest(err)
+	}
+	return body, nil
+}
+
+func (c *HttpClient) url(params url.Values) string {
+	params.Set("format", "json")
+	params.Set("formatversion", "2")
+	return c.baseUrl + "?" + params.Encode()
+}
+
+func (c *HttpClient) searchUrl(query string, offset int, token string) string {
+	params := url.Values{
+		"action":    {"query"},
+		"list":      {"search"},
+		"redirects": {"1"},
+		"srprop":    {"size|wordcount|timestamp|snippet"},
+		"srinfo":    {"totalhits"},
+		"srlimit":   {strconv.Itoa(searchLimit)},
+		"srsearch":  {query},
+	}
+	if offset > 0 {
+		params.Set("sroffset", strconv.Itoa(offset))
+		params.Set("continue", token)
+	}
+	return c.url(params)
+}
+
+// Search returns a page of results, starting at offset. Pages after the first
+// need the continue token returned with the one before.
+func (c *HttpClient) Search(ctx context.Context, query string, offset int, token string) (*QueryResult, error) {
+	log.Info("wiki", "query", query, "offset", offset)
+
 	result := QueryResult{}
-	return &result, json.NewDecoder(res.Body).Decode(&result)
+	if err := c.get(ctx, c.searchUrl(query, offset, token), &result); err != nil {
+		return nil, err
+	}
+	result.SearchQuery = query
+	result.Offset = offset
+	return &result, nil
+}
+
+func (c *HttpClient) suggestUrl(prefix string) string {
+	return c.url(url.Values{
+		"action":    {"opensearch"},
+		"namespace": {"0"},
+		"redirects": {"resolve"},
+		"limit":     {strconv.Itoa(suggestLimit)},
+		"search":    {prefix},
+	})
+}
+
+// Suggest returns titles starting with prefix. The opensearch response is a
+// list of [query, titles, descriptions, urls].
+func (c *HttpClient) Suggest(ctx context.Context, prefix string) ([]string, error) {
+	result := []json.RawMessage{}
+	if err := c.get(ctx, c.suggestUrl(prefix), &result); err != nil {
+		return nil, err
+	}
+	if len(result) < 2 {
+		return []string{}, nil
+	}
+
+	titles := []string{}
+	return titles, json.Unmarshal(result[1], &titles)
 }
 
 // https://oldschool.runescape.wiki/api.php?action=parse&format=json&pageid=44134&prop=categories%7Csections%7Crevid%7Cdisplaytitle%7Ciwlinks%7Cproperties%7Cparsewarnings%7Cwikitext&formatversion=2
-func pageUrl(msg cmd.OpenArticle) string {
-	baseUrl := "https://oldschool.runescape.wiki/api.php?action=parse&format=json&prop=categories%7Csections%7Crevid%7Cdisplaytitle%7Ciwlinks%7Cproperties%7Cparsewarnings%7Cwikitext&formatversion=2"
-	var searchParam string
+func (c *HttpClient) pageUrl(msg cmd.OpenArticle) string {
+	params := url.Values{
+		"action":    {"parse"},
+		"prop":      {"categories|sections|revid|displaytitle|iwlinks|properties|parsewarnings|wikitext"},
+		"redirects": {"1"},
+	}
 	if msg.PageId != 0 {
-		searchParam = "pageid=" + strconv.Itoa(msg.PageId)
+		params.Set("pageid", strconv.Itoa(msg.PageId))
 	} else {
-		searchParam = "page=" + msg.Name
+		params.Set("page", msg.Name)
 	}
-	return baseUrl + "&" + searchParam
+	return c.url(params)
 }
-func ParsePage(msg cmd.OpenArticle) (*Page, error) {
-	client := getHttpClient()
+func (c *HttpClient) ParsePage(ctx context.Context, msg cmd.OpenArticle) (*Page, error) {
+	if c.cache != nil {
+		if page, fresh := c.cache.Get(msg); page != nil {
+			if fresh {
+				return page, nil
+			}
+			revId, err := c.latestRevision(ctx, page.PageID)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err != nil {
+				// Better to show a possibly outdated page than nothing at all.
+				log.Warn("wiki", "msg", "serving unvalidated page", "page", page.Title, "err", err)
+				return page, nil
+			}
+			if revId == page.RevId {
+				c.cache.Touch(page.PageID)
+				return page, nil
+			}
+		}
+	}
 
-	res, err := client.Get(pageUrl(msg))
-	if err != nil {
+	if msg.PageId == 0 && NormalizeTitle(msg.Name) == "" {
+		return nil, &Error{Kind: MissingTitleError}
+	}
+
+	result := ParseResult{}
+	if err := c.get(ctx, c.pageUrl(msg), &result); err != nil {
+		var wikiErr *Error
+		if errors.As(err, &wikiErr) && wikiErr.Kind == MissingTitleError {
+			titled := *wikiErr
+			titled.Title = msg.Name
+			err = &titled
+		}
 		log.Error("wiki", "err", err)
 		return nil, err
 	}
+	if result.Parse.PageID == 0 {
+		return nil, &Error{Kind: NotFoundError}
+	}
 
-	defer res.Body.Close()
+	if c.cache != nil {
+		c.cache.Put(&result.Parse, msg.Name)
+	}
+	return &result.Parse, nil
+}
 
-	result := ParseResult{}
-	err = json.NewDecoder(res.Body).Decode(&result)
+func (c *HttpClient) revisionUrl(pageId int) string {
+	return c.url(url.Values{
+		"action":  {"query"},
+		"prop":    {"revisions"},
+		"rvprop":  {"ids"},
+		"pageids": {strconv.Itoa(pageId)},
+	})
+}
+func (c *HttpClient) latestRevision(ctx context.Context, pageId int) (int, error) {
+	result := RevisionResult{}
+	if err := c.get(ctx, c.revisionUrl(pageId), &result); err != nil {
+		return 0, err
+	}
+
+	for _, p := range result.Query.Pages {
+		if p.PageID == pageId && len(p.Revisions) > 0 {
+			return p.Revisions[0].RevId, nil
+		}
+	}
+	return 0, errors.New("no revision found")
+}
+
+// pricesUrl expands a {{GEPrice}} template per item, one per line.
+func (c *HttpClient) pricesUrl(items []string) string {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		lines[i] = "{{GEPrice|" + item + "}}"
+	}
+	return c.url(url.Values{
+		"action": {"expandtemplates"},
+		"prop":   {"wikitext"},
+		"text":   {strings.Join(lines, "\n")},
+	})
+}
+
+// Prices returns the Grand Exchange price of every tradeable item.
+func (c *HttpClient) Prices(ctx context.Context, items []string) (map[string]int, error) {
+	result := ExpandResult{}
+	if err := c.get(ctx, c.pricesUrl(items), &result); err != nil {
+		return nil, err
+	}
 
-	return &result.Parse, err
+	prices := map[string]int{}
+	lines := strings.Split(result.ExpandTemplates.WikiText, "\n")
+	for i, item := range items {
+		if i >= len(lines) {
+			break
+		}
+		// Items that are not traded expand to an error message instead.
+		price, err := strconv.Atoi(strings.ReplaceAll(strings.TrimSpace(lines[i]), ",", ""))
+		if err == nil {
+			prices[item] = price
+		}
+	}
+	return prices, nil
 }